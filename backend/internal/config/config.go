@@ -2,9 +2,21 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// Bounds for chunked network log fetches, from config or per-request overrides
+const (
+	MinLogChunkSize = time.Hour
+	MaxLogChunkSize = 7 * 24 * time.Hour
+	MaxLogParallel  = 8
 )
 
 // Config holds the application configuration
@@ -17,11 +29,36 @@ type Config struct {
 	TailscaleOAuthScopes       []string
 	Port                       string
 	Environment                string
+	GeoIPDatabase              string
+	RateLimitRPS               float64
+	RateLimitBurst             int
+	UpstreamTimeout            time.Duration
+	UpstreamMaxIdleConns       int
+	UpstreamMaxConns           int
+	UpstreamIdleConnTimeout    time.Duration
+	CircuitThreshold           int
+	CircuitCooldown            time.Duration
+	OnlineThreshold            time.Duration
+	LogChunkSize               time.Duration
+	LogMaxParallel             int
+	LogFormat                  string
+	MaxLogs                    int
+	SampleCeiling              int
+	AuthToken                  string
+	BasicAuthUser              string
+	BasicAuthPassword          string
+	AdminToken                 string
+	CORSOrigins                []string
+	TrustedProxies             []string
+	MaxResponseBytes           int
+
+	// loadErrors collects malformed values found by Load, reported by Validate
+	loadErrors []error
 }
 
 // Load loads configuration from environment variables
 func Load() *Config {
-	return &Config{
+	cfg := &Config{
 		TailscaleAPIKey:            os.Getenv("TAILSCALE_API_KEY"),
 		TailscaleTailnet:           getEnvWithDefault("TAILSCALE_TAILNET", "-"),
 		TailscaleAPIURL:            getEnvWithDefault("TAILSCALE_API_URL", "https://api.tailscale.com"),
@@ -30,7 +67,38 @@ func Load() *Config {
 		TailscaleOAuthScopes:       parseScopes(os.Getenv("TAILSCALE_OAUTH_SCOPES")),
 		Port:                       getEnvWithDefault("PORT", "8080"),
 		Environment:                getEnvWithDefault("ENVIRONMENT", "development"),
+		GeoIPDatabase:              os.Getenv("TSFLOW_GEOIP_DB"),
 	}
+
+	cfg.RateLimitRPS = cfg.getEnvFloat("TSFLOW_RATE_LIMIT_RPS", 5)
+	cfg.RateLimitBurst = cfg.getEnvInt("TSFLOW_RATE_LIMIT_BURST", 20)
+	cfg.UpstreamTimeout = cfg.getEnvDuration("TSFLOW_UPSTREAM_TIMEOUT", 60*time.Second)
+	cfg.UpstreamMaxIdleConns = cfg.getEnvInt("TSFLOW_UPSTREAM_MAX_IDLE_CONNS", 16)
+	cfg.UpstreamMaxConns = cfg.getEnvInt("TSFLOW_UPSTREAM_MAX_CONNS", 32)
+	cfg.UpstreamIdleConnTimeout = cfg.getEnvDuration("TSFLOW_UPSTREAM_IDLE_CONN_TIMEOUT", 90*time.Second)
+	cfg.CircuitThreshold = cfg.getEnvInt("TSFLOW_CIRCUIT_THRESHOLD", 5)
+	cfg.CircuitCooldown = cfg.getEnvDuration("TSFLOW_CIRCUIT_COOLDOWN", 30*time.Second)
+	cfg.OnlineThreshold = cfg.getEnvDuration("TSFLOW_ONLINE_THRESHOLD", 2*time.Minute)
+	cfg.LogChunkSize = cfg.getEnvDuration("TSFLOW_LOG_CHUNK_SIZE", 24*time.Hour)
+	cfg.LogMaxParallel = cfg.getEnvInt("TSFLOW_LOG_MAX_PARALLEL", 2)
+	cfg.MaxLogs = cfg.getEnvInt("TSFLOW_MAX_LOGS", 100000)
+	cfg.SampleCeiling = cfg.getEnvInt("TSFLOW_SAMPLE_CEILING", 50000)
+	cfg.LogFormat = strings.ToLower(getEnvWithDefault("TSFLOW_LOG_FORMAT", "text"))
+	cfg.CORSOrigins = parseList(os.Getenv("TSFLOW_CORS_ORIGINS"))
+	cfg.TrustedProxies = parseList(os.Getenv("TSFLOW_TRUSTED_PROXIES"))
+	cfg.MaxResponseBytes = cfg.getEnvInt("TSFLOW_MAX_RESPONSE_BYTES", 256<<20)
+	cfg.AuthToken = os.Getenv("TSFLOW_AUTH_TOKEN")
+	cfg.AdminToken = os.Getenv("TSFLOW_ADMIN_TOKEN")
+	if basicAuth := os.Getenv("TSFLOW_BASIC_AUTH"); basicAuth != "" {
+		user, password, ok := strings.Cut(basicAuth, ":")
+		if !ok || user == "" {
+			cfg.loadErrors = append(cfg.loadErrors, errors.New("TSFLOW_BASIC_AUTH: expected user:password"))
+		} else {
+			cfg.BasicAuthUser, cfg.BasicAuthPassword = user, password
+		}
+	}
+
+	return cfg
 }
 
 // Validate validates the configuration
@@ -46,6 +114,88 @@ func (c *Config) Validate() error {
 		log.Println("Both API key and OAuth credentials provided. OAuth will take precedence.")
 	}
 
+	if len(c.loadErrors) > 0 {
+		return errors.Join(c.loadErrors...)
+	}
+
+	if c.RateLimitRPS < 0 {
+		return errors.New("TSFLOW_RATE_LIMIT_RPS must not be negative (0 disables rate limiting)")
+	}
+	if c.RateLimitRPS > 0 && c.RateLimitBurst < 1 {
+		return errors.New("TSFLOW_RATE_LIMIT_BURST must be at least 1")
+	}
+
+	if c.UpstreamTimeout <= 0 {
+		return errors.New("TSFLOW_UPSTREAM_TIMEOUT must be positive")
+	}
+	if c.UpstreamMaxIdleConns < 1 {
+		return errors.New("TSFLOW_UPSTREAM_MAX_IDLE_CONNS must be at least 1")
+	}
+	if c.UpstreamMaxConns < 0 {
+		return errors.New("TSFLOW_UPSTREAM_MAX_CONNS must not be negative (0 means no limit)")
+	}
+	if c.UpstreamIdleConnTimeout <= 0 {
+		return errors.New("TSFLOW_UPSTREAM_IDLE_CONN_TIMEOUT must be positive")
+	}
+	if c.CircuitThreshold < 0 {
+		return errors.New("TSFLOW_CIRCUIT_THRESHOLD must not be negative (0 disables the circuit breaker)")
+	}
+	if c.CircuitThreshold > 0 && c.CircuitCooldown <= 0 {
+		return errors.New("TSFLOW_CIRCUIT_COOLDOWN must be positive")
+	}
+
+	if c.OnlineThreshold <= 0 {
+		return errors.New("TSFLOW_ONLINE_THRESHOLD must be positive")
+	}
+
+	if c.LogChunkSize < MinLogChunkSize || c.LogChunkSize > MaxLogChunkSize {
+		return fmt.Errorf("TSFLOW_LOG_CHUNK_SIZE must be between %s and %s", MinLogChunkSize, MaxLogChunkSize)
+	}
+	if c.LogMaxParallel < 1 || c.LogMaxParallel > MaxLogParallel {
+		return fmt.Errorf("TSFLOW_LOG_MAX_PARALLEL must be between 1 and %d", MaxLogParallel)
+	}
+	if c.MaxLogs < 1 {
+		return errors.New("TSFLOW_MAX_LOGS must be at least 1")
+	}
+	if c.SampleCeiling < 1 {
+		return errors.New("TSFLOW_SAMPLE_CEILING must be at least 1")
+	}
+	// Chunked logs are truncated at MaxLogs before sampling, so a higher
+	// ceiling could never be reached
+	if c.SampleCeiling > c.MaxLogs {
+		return fmt.Errorf("TSFLOW_SAMPLE_CEILING (%d) must not exceed TSFLOW_MAX_LOGS (%d)", c.SampleCeiling, c.MaxLogs)
+	}
+
+	for _, origin := range c.CORSOrigins {
+		if origin == "*" {
+			if len(c.CORSOrigins) > 1 {
+				return errors.New("TSFLOW_CORS_ORIGINS: * cannot be combined with other origins")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("TSFLOW_CORS_ORIGINS: invalid origin %q, expected scheme://host[:port]", origin)
+		}
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			return fmt.Errorf("TSFLOW_TRUSTED_PROXIES: invalid proxy %q, expected an IP or CIDR", proxy)
+		}
+	}
+
+	if c.MaxResponseBytes < 0 {
+		return errors.New("TSFLOW_MAX_RESPONSE_BYTES must not be negative (0 disables the limit)")
+	}
+
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("TSFLOW_LOG_FORMAT must be text or json, got %q", c.LogFormat)
+	}
+
 	return nil
 }
 
@@ -57,6 +207,62 @@ func getEnvWithDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvFloat parses a numeric environment variable, recording an error and
+// returning the default if it is malformed
+func (c *Config) getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		c.loadErrors = append(c.loadErrors, fmt.Errorf("%s: invalid number %q", key, value))
+		return defaultValue
+	}
+	return f
+}
+
+// getEnvInt parses an integer environment variable, recording an error and
+// returning the default if it is malformed
+func (c *Config) getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		c.loadErrors = append(c.loadErrors, fmt.Errorf("%s: invalid integer %q", key, value))
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvDuration parses a Go duration environment variable (e.g. "90s"),
+// recording an error and returning the default if it is malformed
+func (c *Config) getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		c.loadErrors = append(c.loadErrors, fmt.Errorf("%s: invalid duration %q", key, value))
+		return defaultValue
+	}
+	return d
+}
+
+// parseList splits a comma-separated value, trimming spaces and dropping empty items
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // parseScopes parses a comma-separated string of OAuth scopes
 func parseScopes(scopesStr string) []string {
 	if scopesStr == "" {
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadDefaultsValidate(t *testing.T) {
+	t.Setenv("TAILSCALE_API_KEY", "tskey-api-test")
+
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default configuration is invalid: %v", err)
+	}
+	// Chunked logs are truncated at MaxLogs before sampling, so the default
+	// ceiling must fit under the default limit for sampling to be reachable
+	if cfg.SampleCeiling >= cfg.MaxLogs {
+		t.Errorf("default sample ceiling %d is not below the default log limit %d", cfg.SampleCeiling, cfg.MaxLogs)
+	}
+}
+
+func TestValidateSampleCeilingWithinMaxLogs(t *testing.T) {
+	t.Setenv("TAILSCALE_API_KEY", "tskey-api-test")
+
+	tests := []struct {
+		maxLogs, sampleCeiling string
+		wantErr                bool
+	}{
+		{"10000", "10000", false},
+		{"10000", "5000", false},
+		{"10000", "", true},
+		{"10000", "10001", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TSFLOW_MAX_LOGS", tt.maxLogs)
+		t.Setenv("TSFLOW_SAMPLE_CEILING", tt.sampleCeiling)
+		err := Load().Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("max %s, ceiling %q: err = %v, want error %v", tt.maxLogs, tt.sampleCeiling, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), "TSFLOW_SAMPLE_CEILING") {
+			t.Errorf("max %s, ceiling %q: error %q does not name TSFLOW_SAMPLE_CEILING", tt.maxLogs, tt.sampleCeiling, err)
+		}
+	}
+}
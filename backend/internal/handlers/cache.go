@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type cachedResponse struct {
+	body    gin.H
+	expires time.Time
+}
+
+// ttlCache keeps computed response bodies for a short time so dashboards
+// polling the same view don't each trigger upstream API calls
+type ttlCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+}
+
+// get returns the body stored under key if it has not expired
+func (tc *ttlCache) get(key string) (gin.H, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	entry, ok := tc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// set stores body under key for ttl, dropping any entries that have expired
+func (tc *ttlCache) set(key string, body gin.H, ttl time.Duration) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	now := time.Now()
+	if tc.entries == nil {
+		tc.entries = make(map[string]cachedResponse)
+	}
+	for k, entry := range tc.entries {
+		if now.After(entry.expires) {
+			delete(tc.entries, k)
+		}
+	}
+	tc.entries[key] = cachedResponse{body: body, expires: now.Add(ttl)}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetConfig reports the effective, non-secret settings the server is running
+// with, to debug deployments where .env and container env disagree. Secrets
+// are never included; only which kinds of credentials are set.
+func (h *Handlers) GetConfig(c *gin.Context) {
+	cfg := h.cfg
+
+	upstreamAuth := "apikey"
+	if cfg.TailscaleOAuthClientID != "" && cfg.TailscaleOAuthClientSecret != "" {
+		upstreamAuth = "oauth"
+	}
+
+	apiAuth := []string{}
+	if cfg.AuthToken != "" {
+		apiAuth = append(apiAuth, "bearer")
+	}
+	if cfg.BasicAuthUser != "" {
+		apiAuth = append(apiAuth, "basic")
+	}
+
+	// Mirrors the defaults in middleware.CORS
+	corsOrigins := cfg.CORSOrigins
+	if len(corsOrigins) == 0 {
+		corsOrigins = []string{"*"}
+		if cfg.Environment == "production" {
+			corsOrigins = []string{}
+		}
+	}
+
+	trustedProxies := cfg.TrustedProxies
+	if trustedProxies == nil {
+		trustedProxies = []string{}
+	}
+
+	response := gin.H{
+		"tailnet":     cfg.TailscaleTailnet,
+		"apiUrl":      cfg.TailscaleAPIURL,
+		"environment": cfg.Environment,
+		"authMethod":  upstreamAuth,
+		"apiAuth":     apiAuth,
+		"flows": gin.H{
+			"defaultWindow": defaultFlowWindow.String(),
+		},
+		"networkLogs": gin.H{
+			"chunkSize":     cfg.LogChunkSize.String(),
+			"maxParallel":   cfg.LogMaxParallel,
+			"maxLogs":       cfg.MaxLogs,
+			"sampleCeiling": cfg.SampleCeiling,
+		},
+		"upstream": gin.H{
+			"timeout":         cfg.UpstreamTimeout.String(),
+			"maxIdleConns":    cfg.UpstreamMaxIdleConns,
+			"maxConns":        cfg.UpstreamMaxConns,
+			"idleConnTimeout": cfg.UpstreamIdleConnTimeout.String(),
+		},
+		"cache": gin.H{
+			"summaryTTL":      summaryTTL.String(),
+			"deviceDetailTTL": deviceDetailTTL.String(),
+			"readinessTTL":    readinessTTL.String(),
+		},
+		"rateLimit": gin.H{
+			"rps":            cfg.RateLimitRPS,
+			"burst":          cfg.RateLimitBurst,
+			"trustedProxies": trustedProxies,
+		},
+		"corsOrigins":      corsOrigins,
+		"maxResponseBytes": cfg.MaxResponseBytes,
+		"onlineThreshold":  cfg.OnlineThreshold.String(),
+		"logFormat":        cfg.LogFormat,
+		"geoIPEnabled":     cfg.GeoIPDatabase != "",
+	}
+	if cfg.TailscaleOAuthClientID != "" {
+		// The client ID identifies the credential without granting access
+		response["oauthClientId"] = cfg.TailscaleOAuthClientID
+		response["oauthScopes"] = cfg.TailscaleOAuthScopes
+	}
+
+	c.JSON(http.StatusOK, response)
+}
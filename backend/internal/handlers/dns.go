@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/services"
+)
+
+// dnsCallTimeout bounds each upstream call GetDNS makes
+const dnsCallTimeout = 20 * time.Second
+
+// GetDNS returns nameservers, VIP services and static records in one response.
+// The three calls run concurrently, each cancelled after dnsCallTimeout; any that
+// fails or times out yields an empty section and an entry in "warnings" instead
+// of failing the request.
+func (h *Handlers) GetDNS(c *gin.Context) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		warnings = []string{}
+
+		nameservers   map[string]interface{}
+		vipServices   map[string]services.VIPServiceInfo
+		staticRecords map[string]services.StaticRecordInfo
+	)
+
+	warn := func(section string, err error) {
+		log.Printf("WARNING GetDNS %s failed: %v", section, err)
+		mu.Lock()
+		warnings = append(warnings, fmt.Sprintf("%s: %v", section, err))
+		mu.Unlock()
+	}
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dnsCallTimeout)
+		defer cancel()
+		result, err := h.tailscaleService.GetDNSNameservers(ctx)
+		if err != nil {
+			warn("nameservers", err)
+			return
+		}
+		nameservers = result
+	}()
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dnsCallTimeout)
+		defer cancel()
+		result, err := h.tailscaleService.GetVIPServices(ctx)
+		if err != nil {
+			warn("services", err)
+			return
+		}
+		vipServices = result
+	}()
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dnsCallTimeout)
+		defer cancel()
+		result, err := h.tailscaleService.GetStaticRecords(ctx)
+		if err != nil {
+			warn("records", err)
+			return
+		}
+		staticRecords = result
+	}()
+	wg.Wait()
+
+	if nameservers == nil {
+		nameservers = map[string]interface{}{}
+	}
+	if vipServices == nil {
+		vipServices = map[string]services.VIPServiceInfo{}
+	}
+	if staticRecords == nil {
+		staticRecords = map[string]services.StaticRecordInfo{}
+	}
+
+	log.Printf("SUCCESS GetDNS: %d services, %d records, %d warnings", len(vipServices), len(staticRecords), len(warnings))
+	c.JSON(http.StatusOK, gin.H{
+		"nameservers": nameservers,
+		"services":    vipServices,
+		"records":     staticRecords,
+		"warnings":    warnings,
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetDNSReportsFailedSections(t *testing.T) {
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/dns/nameservers":
+			w.Write([]byte(`{"dns":["1.1.1.1"]}`))
+		case "/api/v2/tailnet/example.com/dns/preferences":
+			w.Write([]byte(`{"magicDNS":true}`))
+		case "/api/v2/tailnet/example.com/services":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "/api/v2/tailnet/example.com/static-records":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	w := serve(h.GetDNS, httptest.NewRequest(http.MethodGet, "/api/dns", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var body struct {
+		Nameservers map[string]interface{}     `json:"nameservers"`
+		Services    map[string]json.RawMessage `json:"services"`
+		Records     map[string]json.RawMessage `json:"records"`
+		Warnings    []string                   `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Nameservers["magicDNS"] != true {
+		t.Errorf("nameservers = %v, want the upstream config", body.Nameservers)
+	}
+	if body.Services == nil || len(body.Services) != 0 || body.Records == nil || len(body.Records) != 0 {
+		t.Errorf("services = %v, records = %v, want both empty", body.Services, body.Records)
+	}
+	if len(body.Warnings) != 2 {
+		t.Fatalf("warnings = %q, want services and records", body.Warnings)
+	}
+	joined := strings.Join(body.Warnings, "\n")
+	if !strings.Contains(joined, "services:") || !strings.Contains(joined, "records:") {
+		t.Errorf("warnings = %q, want services and records named", body.Warnings)
+	}
+}
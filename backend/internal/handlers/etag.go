@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jsonWithETag serializes v, tags it with a strong ETag over the body and
+// answers 304 Not Modified when the request's If-None-Match already has it.
+// Because the tag covers the serialized body, any change in query parameters
+// that changes the response also changes the tag. X-Uncompressed-Length
+// reports the body size before the gzip middleware compresses it, and object
+// responses also carry it in metadata (see addSizeMetadata).
+func (h *Handlers) jsonWithETag(c *gin.Context, v interface{}) {
+	body, ok := h.marshalResponse(c, v)
+	if !ok {
+		return
+	}
+	body = addSizeMetadata(c, v, body)
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("X-Uncompressed-Length", strconv.Itoa(len(body)))
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison RFC 9110 requires for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// addSizeMetadata appends a metadata object with responseBytes and compressed
+// to an already encoded object response, so the frontend can choose between a
+// full render and a summary before parsing everything. The field is spliced
+// into body rather than set on v, so the value is encoded only once and shared
+// values such as cached maps are never modified. responseBytes is the exact
+// uncompressed size of the returned body, metadata included; compressed
+// reports whether the gzip middleware is encoding this response. Non-object
+// responses, and objects that already have a metadata field, are returned
+// unchanged.
+func addSizeMetadata(c *gin.Context, v interface{}, body []byte) []byte {
+	switch resp := v.(type) {
+	case map[string]interface{}:
+		if _, exists := resp["metadata"]; exists {
+			return body
+		}
+	case gin.H:
+		if _, exists := resp["metadata"]; exists {
+			return body
+		}
+	default:
+		return body
+	}
+	if len(body) < 2 || body[0] != '{' || body[len(body)-1] != '}' {
+		return body
+	}
+
+	head := body[:len(body)-1]
+	sep := ","
+	if len(body) == 2 {
+		sep = ""
+	}
+	compressed := c.Writer.Header().Get("Content-Encoding") == "gzip"
+	tail := func(n int) string {
+		return fmt.Sprintf(`%s"metadata":{"responseBytes":%d,"compressed":%t}}`, sep, n, compressed)
+	}
+
+	// The size includes its own digits, so grow it until it accounts for them
+	n := len(body)
+	for len(head)+len(tail(n)) != n {
+		n = len(head) + len(tail(n))
+	}
+
+	out := make([]byte, 0, n)
+	out = append(out, head...)
+	return append(out, tail(n)...)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	stdgzip "compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/config"
+)
+
+func newETagRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(nil, &config.Config{})
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.GET("/flows", func(c *gin.Context) {
+		h.jsonWithETag(c, gin.H{"flows": []string{"a", "b"}, "protocol": c.Query("protocols")})
+	})
+	return router
+}
+
+func getWithETag(router *gin.Engine, target, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestJSONWithETagRevalidates(t *testing.T) {
+	router := newETagRouter()
+
+	first := getWithETag(router, "/flows", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status %d, ETag %q", first.Code, etag)
+	}
+
+	second := getWithETag(router, "/flows", etag)
+	if second.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status %d, want %d", second.Code, http.StatusNotModified)
+	}
+	if second.Body.Len() != 0 {
+		t.Errorf("304 carried a %d byte body", second.Body.Len())
+	}
+
+	weak := getWithETag(router, "/flows", `"other", W/`+etag)
+	if weak.Code != http.StatusNotModified {
+		t.Errorf("weak match in a list: status %d, want %d", weak.Code, http.StatusNotModified)
+	}
+}
+
+func TestJSONWithETagChangesWithFilters(t *testing.T) {
+	router := newETagRouter()
+
+	unfiltered := getWithETag(router, "/flows", "")
+	filtered := getWithETag(router, "/flows?protocols=tcp", unfiltered.Header().Get("ETag"))
+	if filtered.Code != http.StatusOK {
+		t.Fatalf("filtered request with the unfiltered ETag: status %d, want %d", filtered.Code, http.StatusOK)
+	}
+	if filtered.Header().Get("ETag") == unfiltered.Header().Get("ETag") {
+		t.Error("ETag did not change with the filter")
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"x", "abc"`, true},
+		{"*", true},
+		{`"abcd"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestJSONWithETagReportsSize(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantCompressed bool
+	}{
+		{"plain", "", false},
+		{"gzip", "gzip, deflate", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(gzip.Gzip(gzip.DefaultCompression))
+			h := NewHandlers(nil, &config.Config{})
+			router.GET("/map", func(c *gin.Context) {
+				h.jsonWithETag(c, map[string]interface{}{"devices": []string{"a", "b", "c"}})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/map", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d", w.Code)
+			}
+
+			body := w.Body.Bytes()
+			if tt.wantCompressed {
+				zr, err := stdgzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := w.Header().Get("X-Uncompressed-Length"); got != strconv.Itoa(len(body)) {
+				t.Errorf("X-Uncompressed-Length = %s, want %d", got, len(body))
+			}
+
+			var resp struct {
+				Devices  []string `json:"devices"`
+				Metadata struct {
+					ResponseBytes int  `json:"responseBytes"`
+					Compressed    bool `json:"compressed"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			// The size is that of the whole body, metadata included
+			if resp.Metadata.ResponseBytes != len(body) {
+				t.Errorf("responseBytes = %d, want %d", resp.Metadata.ResponseBytes, len(body))
+			}
+			if resp.Metadata.Compressed != tt.wantCompressed {
+				t.Errorf("compressed = %v, want %v", resp.Metadata.Compressed, tt.wantCompressed)
+			}
+		})
+	}
+}
+
+func TestAddSizeMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	tests := []struct {
+		name         string
+		v            interface{}
+		wantMetadata bool
+	}{
+		{"empty object", gin.H{}, true},
+		{"object", map[string]interface{}{"devices": []string{"a"}}, true},
+		// Sizes either side of a digit boundary once metadata is added
+		{"short padding", gin.H{"pad": strings.Repeat("x", 40)}, true},
+		{"long padding", gin.H{"pad": strings.Repeat("x", 9950)}, true},
+		{"existing metadata", gin.H{"logs": []int{}, "metadata": gin.H{"chunked": true}}, false},
+		{"list", []string{"a"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := addSizeMetadata(c, tt.v, body)
+			if !tt.wantMetadata {
+				if string(got) != string(body) {
+					t.Errorf("body changed to %s", got)
+				}
+				return
+			}
+
+			var resp struct {
+				Metadata *struct {
+					ResponseBytes int `json:"responseBytes"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal(got, &resp); err != nil {
+				t.Fatalf("%s: %v", got, err)
+			}
+			if resp.Metadata == nil || resp.Metadata.ResponseBytes != len(got) {
+				t.Errorf("metadata %+v, want responseBytes %d", resp.Metadata, len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,956 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/services"
+	"github.com/rajsinghtech/tsflow/backend/internal/utils"
+)
+
+// defaultFlowWindow is the time range used by flow endpoints when no start/end is given
+const defaultFlowWindow = time.Hour
+
+// exportFlushLines is how many lines ExportFlowSummary buffers between flushes
+const exportFlushLines = 1000
+
+// fetchRawFlows parses the request's time range and fetches the flows in it
+// that match the request's filters (see parseFlowFilters). Flow timestamps and
+// the returned range are in the ?tz= zone, and ?humanize=true adds readable
+// byte counts. On failure it writes the error response and returns ok=false.
+func (h *Handlers) fetchRawFlows(c *gin.Context, caller string) (flows []services.RawFlowEntry, start, end time.Time, ok bool) {
+	return h.fetchFlows(c, caller, nil)
+}
+
+// fetchRawFlowsWithDevices is fetchRawFlows for handlers that have already
+// fetched the device list, so the flows are named without fetching it again
+func (h *Handlers) fetchRawFlowsWithDevices(c *gin.Context, caller string, devices []services.Device) (flows []services.RawFlowEntry, start, end time.Time, ok bool) {
+	if devices == nil {
+		devices = []services.Device{}
+	}
+	return h.fetchFlows(c, caller, devices)
+}
+
+// fetchFlows implements fetchRawFlows. A nil devices means the device list has
+// not been fetched yet.
+func (h *Handlers) fetchFlows(c *gin.Context, caller string, devices []services.Device) (flows []services.RawFlowEntry, start, end time.Time, ok bool) {
+	start, end, err := parseTimeRange(c, defaultFlowWindow)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid time range",
+			"message": err.Error(),
+		})
+		return nil, start, end, false
+	}
+
+	loc, err := parseTimeZone(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid tz",
+			"message": err.Error(),
+		})
+		return nil, start, end, false
+	}
+
+	filter, err := parseFlowFilters(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid filter",
+			"message": err.Error(),
+		})
+		return nil, start, end, false
+	}
+
+	humanize, err := parseHumanize(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid humanize",
+			"message": err.Error(),
+		})
+		return nil, start, end, false
+	}
+
+	if filter.NeedsDevices() {
+		if devices == nil {
+			if devices, ok = h.filterDevices(c, caller); !ok {
+				return nil, start, end, false
+			}
+		}
+		filter.SetDevices(devices)
+	}
+
+	if devices != nil {
+		flows, err = h.tailscaleService.GetRawFlowsWithDevices(c.Request.Context(), start, end, devices)
+	} else {
+		flows, err = h.tailscaleService.GetRawFlows(c.Request.Context(), start, end)
+	}
+	if err != nil {
+		log.Printf("%sERROR %s failed: %v", utils.LogPrefix(c.Request.Context()), caller, err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch network flows",
+			"message": err.Error(),
+		})
+		return nil, start, end, false
+	}
+
+	flows = services.FilterRawFlows(flows, filter)
+	localizeFlows(flows, loc)
+	if humanize {
+		services.HumanizeBytes(flows)
+	}
+
+	return flows, start.In(loc), end.In(loc), true
+}
+
+// localizeFlows moves each flow's timestamps into loc for display; the
+// instants they denote are unchanged
+func localizeFlows(flows []services.RawFlowEntry, loc *time.Location) {
+	for i := range flows {
+		flows[i].Timestamp = flows[i].Timestamp.In(loc)
+		flows[i].StartTime = flows[i].StartTime.In(loc)
+		flows[i].EndTime = flows[i].EndTime.In(loc)
+	}
+}
+
+// parseFlowFilters reads the optional flow filters shared by the flow endpoints
+// and /api/network-logs: comma-separated ports, protocols (names or numbers),
+// flowTypes and directions, minBytes/maxBytes, minPackets/maxPackets,
+// excludeProto0, comma-separated srcCidr/dstCidr prefixes, and comma-separated
+// device tags and users. Tags may omit the "tag:" prefix.
+func parseFlowFilters(c *gin.Context) (services.FlowFilter, error) {
+	filter, _, err := parseFlowFiltersWithWarnings(c)
+	return filter, err
+}
+
+// parseFlowFiltersWithWarnings is parseFlowFilters, also describing each value
+// it accepted but read differently from how it was given, or that can never
+// match a flow
+func parseFlowFiltersWithWarnings(c *gin.Context) (services.FlowFilter, []string, error) {
+	var filter services.FlowFilter
+	warnings := []string{}
+
+	if raw := c.Query("ports"); raw != "" {
+		filter.Ports = make(map[string]bool)
+		for _, port := range strings.Split(raw, ",") {
+			port = strings.TrimSpace(port)
+			n, err := strconv.Atoi(port)
+			if err != nil || n < 0 || n > 65535 {
+				return filter, warnings, fmt.Errorf("invalid port %q", port)
+			}
+			// Flow ports are canonical, so "080" must be matched as "80"
+			if canonical := strconv.Itoa(n); canonical != port {
+				warnings = append(warnings, fmt.Sprintf("port %q read as %s", port, canonical))
+				port = canonical
+			}
+			filter.Ports[port] = true
+		}
+	}
+
+	if raw := c.Query("protocols"); raw != "" {
+		filter.Protocols = make(map[string]bool)
+		for _, protocol := range strings.Split(raw, ",") {
+			if protocol = strings.ToLower(strings.TrimSpace(protocol)); protocol != "" {
+				if !services.KnownProtocol(protocol) {
+					warnings = append(warnings, fmt.Sprintf("protocol %q is not a known protocol and matches no flows", protocol))
+				}
+				filter.Protocols[protocol] = true
+			}
+		}
+	}
+
+	if raw := c.Query("flowTypes"); raw != "" {
+		filter.FlowTypes = make(map[string]bool)
+		for _, flowType := range strings.Split(raw, ",") {
+			flowType = strings.ToLower(strings.TrimSpace(flowType))
+			switch flowType {
+			case services.FlowTypeVirtual, services.FlowTypeSubnet, services.FlowTypeExit, services.FlowTypePhysical:
+				filter.FlowTypes[flowType] = true
+			default:
+				return filter, warnings, fmt.Errorf("invalid flow type %q, expected virtual, subnet, exit or physical", flowType)
+			}
+		}
+	}
+
+	if raw := c.Query("directions"); raw != "" {
+		// Unknown directions are kept, and so match no flows
+		filter.Directions = make(map[string]bool)
+		for _, direction := range strings.Split(raw, ",") {
+			if direction = strings.ToLower(strings.TrimSpace(direction)); direction != "" {
+				switch direction {
+				case services.FlowDirectionOutbound, services.FlowDirectionInbound, services.FlowDirectionBidirectional:
+				default:
+					warnings = append(warnings, fmt.Sprintf("direction %q is not outbound, inbound or bidirectional and matches no flows", direction))
+				}
+				filter.Directions[direction] = true
+			}
+		}
+	}
+
+	if raw := c.Query("tags"); raw != "" {
+		filter.Tags = make(map[string]bool)
+		for _, tag := range strings.Split(raw, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				if !strings.HasPrefix(tag, "tag:") {
+					warnings = append(warnings, fmt.Sprintf("tag %q read as %q", tag, "tag:"+tag))
+					tag = "tag:" + tag
+				}
+				filter.Tags[tag] = true
+			}
+		}
+	}
+
+	if raw := c.Query("users"); raw != "" {
+		filter.Users = make(map[string]bool)
+		for _, user := range strings.Split(raw, ",") {
+			if user = strings.ToLower(strings.TrimSpace(user)); user != "" {
+				filter.Users[user] = true
+			}
+		}
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value *int64
+	}{
+		{"minBytes", &filter.MinBytes},
+		{"maxBytes", &filter.MaxBytes},
+		{"minPackets", &filter.MinPackets},
+		{"maxPackets", &filter.MaxPackets},
+	} {
+		if raw := c.Query(bound.name); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return filter, warnings, fmt.Errorf("%s must be a non-negative integer", bound.name)
+			}
+			*bound.value = n
+		}
+	}
+	if filter.MaxBytes > 0 && filter.MaxBytes < filter.MinBytes {
+		return filter, warnings, errors.New("maxBytes must not be less than minBytes")
+	}
+	if filter.MaxPackets > 0 && filter.MaxPackets < filter.MinPackets {
+		return filter, warnings, errors.New("maxPackets must not be less than minPackets")
+	}
+
+	if raw := c.Query("excludeProto0"); raw != "" {
+		exclude, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, warnings, errors.New("excludeProto0 must be true or false")
+		}
+		filter.ExcludeUnknownProtocol = exclude
+	}
+
+	for _, cidrs := range []struct {
+		name  string
+		value *[]netip.Prefix
+	}{{"srcCidr", &filter.SourceCIDRs}, {"dstCidr", &filter.DestCIDRs}} {
+		raw := c.Query(cidrs.name)
+		if raw == "" {
+			continue
+		}
+		for _, cidr := range strings.Split(raw, ",") {
+			cidr = strings.TrimSpace(cidr)
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return filter, warnings, fmt.Errorf("invalid %s %q", cidrs.name, cidr)
+			}
+			if masked := prefix.Masked(); masked != prefix {
+				warnings = append(warnings, fmt.Sprintf("%s %q read as %s", cidrs.name, cidr, masked))
+				prefix = masked
+			}
+			*cidrs.value = append(*cidrs.value, prefix)
+		}
+	}
+
+	return filter, warnings, nil
+}
+
+// ValidateFilters parses the flow filters and ?limit= as the flow endpoints
+// would, without fetching any flows. It returns the normalized filters and a
+// warning for each value that was read differently from how it was given or
+// can never match; invalid values get the same 400 a flow endpoint returns.
+func (h *Handlers) ValidateFilters(c *gin.Context) {
+	filter, warnings, err := parseFlowFiltersWithWarnings(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid filter",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	limit, clamped, err := parseSearchLimit(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid limit",
+			"message": err.Error(),
+		})
+		return
+	}
+	if clamped {
+		warnings = append(warnings, fmt.Sprintf("limit %s clamped to %d", c.Query("limit"), maxFlowSearchLimit))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"filters":  flowFilterJSON(filter),
+		"limit":    limit,
+		"warnings": warnings,
+	})
+}
+
+// flowFilterJSON renders a filter with the query parameter names that select
+// it, each list sorted
+func flowFilterJSON(f services.FlowFilter) gin.H {
+	sortedKeys := func(set map[string]bool) []string {
+		keys := make([]string, 0, len(set))
+		for key := range set {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	prefixes := func(list []netip.Prefix) []string {
+		out := make([]string, len(list))
+		for i, prefix := range list {
+			out[i] = prefix.String()
+		}
+		return out
+	}
+	return gin.H{
+		"ports":         sortedKeys(f.Ports),
+		"protocols":     sortedKeys(f.Protocols),
+		"flowTypes":     sortedKeys(f.FlowTypes),
+		"directions":    sortedKeys(f.Directions),
+		"tags":          sortedKeys(f.Tags),
+		"users":         sortedKeys(f.Users),
+		"minBytes":      f.MinBytes,
+		"maxBytes":      f.MaxBytes,
+		"minPackets":    f.MinPackets,
+		"maxPackets":    f.MaxPackets,
+		"excludeProto0": f.ExcludeUnknownProtocol,
+		"srcCidr":       prefixes(f.SourceCIDRs),
+		"dstCidr":       prefixes(f.DestCIDRs),
+	}
+}
+
+// filterDevices fetches the device list for a filter on device tags or users.
+// On failure it writes the error response and returns ok=false.
+func (h *Handlers) filterDevices(c *gin.Context, caller string) ([]services.Device, bool) {
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR %s failed: %v", utils.LogPrefix(c.Request.Context()), caller, err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	if devices.Devices == nil {
+		return []services.Device{}, true
+	}
+	return devices.Devices, true
+}
+
+// parseHumanize reads the optional ?humanize= flag that adds readable byte
+// counts (e.g. totalBytesHuman) next to the numeric ones
+func parseHumanize(c *gin.Context) (bool, error) {
+	raw := c.Query("humanize")
+	if raw == "" {
+		return false, nil
+	}
+	humanize, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, errors.New("humanize must be true or false")
+	}
+	return humanize, nil
+}
+
+// timeRangeJSON renders a time range the way flow endpoints report it
+func timeRangeJSON(start, end time.Time) gin.H {
+	return gin.H{
+		"start": start.Format(time.RFC3339),
+		"end":   end.Format(time.RFC3339),
+	}
+}
+
+// GetProtocols summarizes traffic per protocol over the requested window
+func (h *Handlers) GetProtocols(c *gin.Context) {
+	flows, start, end, ok := h.fetchRawFlows(c, "GetProtocols")
+	if !ok {
+		return
+	}
+
+	protocols := services.SummarizeByProtocol(flows)
+
+	log.Printf("SUCCESS GetProtocols: %d protocols from %d flows", len(protocols), len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"protocols":  protocols,
+		"totalFlows": len(flows),
+		"timeRange":  timeRangeJSON(start, end),
+	})
+}
+
+// GetPorts summarizes traffic per destination port over the requested window,
+// limited to the ?top= busiest ports when given
+func (h *Handlers) GetPorts(c *gin.Context) {
+	top := 0
+	if raw := c.Query("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid top",
+				"message": "top must be a positive integer",
+			})
+			return
+		}
+		top = n
+	}
+
+	flows, start, end, ok := h.fetchRawFlows(c, "GetPorts")
+	if !ok {
+		return
+	}
+
+	ports := services.SummarizeByPort(flows)
+	totalPorts := len(ports)
+	if top > 0 && len(ports) > top {
+		ports = ports[:top]
+	}
+
+	log.Printf("SUCCESS GetPorts: %d of %d ports from %d flows", len(ports), totalPorts, len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"ports":      ports,
+		"totalPorts": totalPorts,
+		"totalFlows": len(flows),
+		"timeRange":  timeRangeJSON(start, end),
+	})
+}
+
+const (
+	defaultFlowSearchLimit = 1000
+	maxFlowSearchLimit     = 10000
+)
+
+// parseSearchLimit reads ?limit= for SearchFlows, defaulting to
+// defaultFlowSearchLimit. clamped reports a limit lowered to maxFlowSearchLimit.
+func parseSearchLimit(c *gin.Context) (limit int, clamped bool, err error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultFlowSearchLimit, false, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, false, errors.New("limit must be a positive integer")
+	}
+	return min(n, maxFlowSearchLimit), n > maxFlowSearchLimit, nil
+}
+
+// SearchFlows returns flows matching ?q= in an IP, port, device name or
+// hostname, or protocol, returning at most ?limit= flows
+func (h *Handlers) SearchFlows(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "missing query",
+			"message": "q is required",
+		})
+		return
+	}
+
+	limit, _, err := parseSearchLimit(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid limit",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR SearchFlows failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlowsWithDevices(c, "SearchFlows", devices.Devices)
+	if !ok {
+		return
+	}
+
+	matches := services.SearchRawFlows(devices.Devices, flows, q)
+	total := len(matches)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	log.Printf("SUCCESS SearchFlows: %d of %d matches for %q in %d flows", len(matches), total, q, len(flows))
+	h.sizedJSON(c, gin.H{
+		"query":        q,
+		"flows":        matches,
+		"totalMatches": total,
+		"truncated":    total > len(matches),
+		"timeRange":    timeRangeJSON(start, end),
+	})
+}
+
+// ExportFlowSummary streams the flows in the requested window as plain text,
+// one tcpdump-style line per flow in start time order. This is not a pcap; it
+// is meant for grep and other line-oriented tooling.
+func (h *Handlers) ExportFlowSummary(c *gin.Context) {
+	flows, _, _, ok := h.fetchRawFlows(c, "ExportFlowSummary")
+	if !ok {
+		return
+	}
+
+	sort.SliceStable(flows, func(i, j int) bool {
+		return flows[i].StartTime.Before(flows[j].StartTime)
+	})
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("X-Flow-Summary-Format", services.FlowSummaryFormat)
+	c.Status(http.StatusOK)
+
+	w := bufio.NewWriter(c.Writer)
+	for i, flow := range flows {
+		if _, err := w.WriteString(services.FormatFlowSummary(flow) + "\n"); err != nil {
+			log.Printf("ERROR ExportFlowSummary write failed: %v", err)
+			return
+		}
+		if (i+1)%exportFlushLines == 0 {
+			if err := w.Flush(); err != nil {
+				log.Printf("ERROR ExportFlowSummary write failed: %v", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("ERROR ExportFlowSummary write failed: %v", err)
+		return
+	}
+	c.Writer.Flush()
+
+	log.Printf("SUCCESS ExportFlowSummary: %d flows", len(flows))
+}
+
+const (
+	// defaultTimeSeriesInterval is the bucket width GetFlowTimeSeries uses by default
+	defaultTimeSeriesInterval = time.Minute
+	// maxTimeSeriesBuckets bounds how many buckets one time series request returns
+	maxTimeSeriesBuckets = 2000
+)
+
+// GetFlowTimeSeries totals bytes, packets and flows per ?interval= (default
+// 1m) bucket over the requested window, for throughput charts. A window that
+// would need more than 2000 buckets is rejected before anything is fetched.
+func (h *Handlers) GetFlowTimeSeries(c *gin.Context) {
+	interval := defaultTimeSeriesInterval
+	if raw := c.Query("interval"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid interval",
+				"message": "interval must be a duration of at least 1s, such as 1m or 1h",
+			})
+			return
+		}
+		interval = d
+	}
+
+	start, end, err := parseTimeRange(c, defaultFlowWindow)
+	if err == nil {
+		if n := services.BucketCount(start, end, interval); n > maxTimeSeriesBuckets {
+			err = fmt.Errorf("interval %s splits the range into %d buckets, over the limit of %d", interval, n, maxTimeSeriesBuckets)
+		}
+	}
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid time range",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlows(c, "GetFlowTimeSeries")
+	if !ok {
+		return
+	}
+
+	buckets := services.BucketFlowsByInterval(flows, start, end, interval)
+
+	log.Printf("SUCCESS GetFlowTimeSeries: %d buckets from %d flows", len(buckets), len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"interval":   interval.String(),
+		"buckets":    buckets,
+		"totalFlows": len(flows),
+		"timeRange":  timeRangeJSON(start, end),
+	})
+}
+
+// exitNodeTopCountries is how many destination countries are listed per exit node
+const exitNodeTopCountries = 5
+
+// GetExitNodeTraffic reports internet-bound traffic per exit node over the requested window
+func (h *Handlers) GetExitNodeTraffic(c *gin.Context) {
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetExitNodeTraffic failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlowsWithDevices(c, "GetExitNodeTraffic", devices.Devices)
+	if !ok {
+		return
+	}
+
+	exitNodes := services.SummarizeExitNodeTraffic(devices.Devices, flows, exitNodeTopCountries)
+
+	log.Printf("SUCCESS GetExitNodeTraffic: %d exit nodes from %d flows", len(exitNodes), len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"exitNodes": exitNodes,
+		"timeRange": timeRangeJSON(start, end),
+	})
+}
+
+// defaultAnomalyK is the default number of standard deviations above the mean
+// a flow must reach to be flagged
+const defaultAnomalyK = 3.0
+
+// GetFlowAnomalies flags flows with unusually high byte counts for their
+// protocol and destination port. ?k= sets the threshold in standard deviations.
+func (h *Handlers) GetFlowAnomalies(c *gin.Context) {
+	k := defaultAnomalyK
+	if raw := c.Query("k"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) || parsed <= 0 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid k",
+				"message": "k must be a positive number",
+			})
+			return
+		}
+		k = parsed
+	}
+
+	flows, start, end, ok := h.fetchRawFlows(c, "GetFlowAnomalies")
+	if !ok {
+		return
+	}
+
+	anomalies := services.DetectByteOutliers(flows, k)
+
+	log.Printf("SUCCESS GetFlowAnomalies: %d anomalies in %d flows (k=%g)", len(anomalies), len(flows), k)
+	c.JSON(http.StatusOK, gin.H{
+		"anomalies":     anomalies,
+		"k":             k,
+		"minBucketSize": services.MinAnomalyBucketSize,
+		"totalFlows":    len(flows),
+		"timeRange":     timeRangeJSON(start, end),
+	})
+}
+
+// GetRetransmitHotspots flags flows with an unusually small average packet
+// size, a hint of retransmits or tiny-packet floods. ?maxAvgPacketBytes= sets
+// the threshold.
+func (h *Handlers) GetRetransmitHotspots(c *gin.Context) {
+	maxAvg := float64(services.DefaultMaxAvgPacketBytes)
+	if raw := c.Query("maxAvgPacketBytes"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) || parsed <= 0 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid maxAvgPacketBytes",
+				"message": "maxAvgPacketBytes must be a positive number",
+			})
+			return
+		}
+		maxAvg = parsed
+	}
+
+	flows, start, end, ok := h.fetchRawFlows(c, "GetRetransmitHotspots")
+	if !ok {
+		return
+	}
+
+	hotspots := services.DetectSmallPacketFlows(flows, maxAvg)
+
+	log.Printf("SUCCESS GetRetransmitHotspots: %d hotspots in %d flows (maxAvgPacketBytes=%g)", len(hotspots), len(flows), maxAvg)
+	c.JSON(http.StatusOK, gin.H{
+		"hotspots":          hotspots,
+		"maxAvgPacketBytes": maxAvg,
+		"minPackets":        services.MinSmallPacketCount,
+		"totalFlows":        len(flows),
+		"timeRange":         timeRangeJSON(start, end),
+	})
+}
+
+const (
+	defaultSankeyLinks = 50
+	maxSankeyLinks     = 500
+)
+
+// GetFlowSankey returns device-to-device byte flows as a Sankey graph, keeping
+// the ?top= heaviest links and merging the rest
+func (h *Handlers) GetFlowSankey(c *gin.Context) {
+	top := defaultSankeyLinks
+	if raw := c.Query("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid top",
+				"message": "top must be a positive integer",
+			})
+			return
+		}
+		top = min(n, maxSankeyLinks)
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetFlowSankey failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlowsWithDevices(c, "GetFlowSankey", devices.Devices)
+	if !ok {
+		return
+	}
+
+	graph := services.BuildSankey(devices.Devices, flows, top)
+
+	log.Printf("SUCCESS GetFlowSankey: %d nodes, %d links from %d flows", len(graph.Nodes), len(graph.Links), len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"nodes":     graph.Nodes,
+		"links":     graph.Links,
+		"timeRange": timeRangeJSON(start, end),
+	})
+}
+
+// GetDevicePairs returns a sparse matrix of bytes between pairs of devices.
+// ?normalize=true adds each cell's fraction of its source device's total.
+func (h *Handlers) GetDevicePairs(c *gin.Context) {
+	normalize := false
+	if raw := c.Query("normalize"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid normalize",
+				"message": "normalize must be true or false",
+			})
+			return
+		}
+		normalize = b
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetDevicePairs failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlowsWithDevices(c, "GetDevicePairs", devices.Devices)
+	if !ok {
+		return
+	}
+
+	matrix, err := services.BuildDevicePairMatrix(devices.Devices, flows, normalize)
+	if errors.Is(err, services.ErrMatrixTooLarge) {
+		errorJSON(c, http.StatusUnprocessableEntity, gin.H{
+			"error":   "Too many devices for a pair matrix",
+			"message": err.Error() + "; narrow the time range",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("%sERROR GetDevicePairs failed to build matrix: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, http.StatusInternalServerError, gin.H{
+			"error":   "Failed to build device pair matrix",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	log.Printf("SUCCESS GetDevicePairs: %d devices, %d pairs from %d flows", len(matrix.Devices), len(matrix.Cells), len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"devices":    matrix.Devices,
+		"cells":      matrix.Cells,
+		"normalized": normalize,
+		"timeRange":  timeRangeJSON(start, end),
+	})
+}
+
+// GetPortScans flags sources that touched at least ?threshold= distinct
+// destination ports on a single target
+func (h *Handlers) GetPortScans(c *gin.Context) {
+	threshold := services.DefaultPortScanThreshold
+	if raw := c.Query("threshold"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 2 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid threshold",
+				"message": "threshold must be an integer of at least 2",
+			})
+			return
+		}
+		threshold = n
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetPortScans failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlowsWithDevices(c, "GetPortScans", devices.Devices)
+	if !ok {
+		return
+	}
+
+	scans := services.DetectPortScans(devices.Devices, flows, threshold)
+
+	log.Printf("SUCCESS GetPortScans: %d suspected scans in %d flows (threshold=%d)", len(scans), len(flows), threshold)
+	c.JSON(http.StatusOK, gin.H{
+		"scans":      scans,
+		"threshold":  threshold,
+		"totalFlows": len(flows),
+		"timeRange":  timeRangeJSON(start, end),
+	})
+}
+
+const (
+	defaultSubnetPrefix4 = 24
+	defaultSubnetPrefix6 = 64
+)
+
+// GetSubnets summarizes traffic per destination subnet, masking IPv4 to
+// ?prefix= bits and IPv6 to ?prefix6= bits, limited to the ?top= busiest
+func (h *Handlers) GetSubnets(c *gin.Context) {
+	top := 0
+	if raw := c.Query("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid top",
+				"message": "top must be a positive integer",
+			})
+			return
+		}
+		top = n
+	}
+
+	prefixes := []struct {
+		name  string
+		value int
+		max   int
+	}{{"prefix", defaultSubnetPrefix4, 32}, {"prefix6", defaultSubnetPrefix6, 128}}
+	for i, prefix := range prefixes {
+		if raw := c.Query(prefix.name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 || n > prefix.max {
+				errorJSON(c, http.StatusBadRequest, gin.H{
+					"error":   "invalid " + prefix.name,
+					"message": fmt.Sprintf("%s must be an integer from 0 to %d", prefix.name, prefix.max),
+				})
+				return
+			}
+			prefixes[i].value = n
+		}
+	}
+	v4Prefix, v6Prefix := prefixes[0].value, prefixes[1].value
+
+	flows, start, end, ok := h.fetchRawFlows(c, "GetSubnets")
+	if !ok {
+		return
+	}
+
+	subnets := services.SummarizeBySubnet(flows, v4Prefix, v6Prefix)
+	totalSubnets := len(subnets)
+	if top > 0 && len(subnets) > top {
+		subnets = subnets[:top]
+	}
+
+	log.Printf("SUCCESS GetSubnets: %d of %d subnets from %d flows", len(subnets), totalSubnets, len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"subnets":      subnets,
+		"totalSubnets": totalSubnets,
+		"prefix":       v4Prefix,
+		"prefix6":      v6Prefix,
+		"totalFlows":   len(flows),
+		"timeRange":    timeRangeJSON(start, end),
+	})
+}
+
+// GetUnresolvedFlows groups the endpoints of flows where neither side matches
+// a device by IP, limited to the ?top= busiest when given
+func (h *Handlers) GetUnresolvedFlows(c *gin.Context) {
+	top := 0
+	if raw := c.Query("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid top",
+				"message": "top must be a positive integer",
+			})
+			return
+		}
+		top = n
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetUnresolvedFlows failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlowsWithDevices(c, "GetUnresolvedFlows", devices.Devices)
+	if !ok {
+		return
+	}
+
+	unresolved := services.CollectUnresolved(devices.Devices, flows)
+	total := len(unresolved)
+	if top > 0 && len(unresolved) > top {
+		unresolved = unresolved[:top]
+	}
+
+	log.Printf("SUCCESS GetUnresolvedFlows: %d of %d unresolved IPs from %d flows", len(unresolved), total, len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"unresolved":      unresolved,
+		"totalUnresolved": total,
+		"totalFlows":      len(flows),
+		"timeRange":       timeRangeJSON(start, end),
+	})
+}
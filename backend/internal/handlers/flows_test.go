@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/services"
+)
+
+func TestParseTimeZone(t *testing.T) {
+	tests := []struct {
+		tz      string
+		want    string
+		wantErr bool
+	}{
+		{"", "UTC", false},
+		{"America/New_York", "America/New_York", false},
+		{"Asia/Kolkata", "Asia/Kolkata", false},
+		{"Local", "", true},
+		{"Mars/Olympus_Mons", "", true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/flows?tz="+tt.tz, nil)
+
+		loc, err := parseTimeZone(c)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("tz=%q: err = %v, wantErr %v", tt.tz, err, tt.wantErr)
+			continue
+		}
+		if err == nil && loc.String() != tt.want {
+			t.Errorf("tz=%q: location %s, want %s", tt.tz, loc, tt.want)
+		}
+	}
+}
+
+func TestLocalizeFlowsKeepsInstants(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2025, 1, 15, 17, 30, 0, 0, time.UTC)
+	flows := []services.RawFlowEntry{{ID: "1", Timestamp: ts, StartTime: ts, EndTime: ts.Add(time.Minute)}}
+
+	localizeFlows(flows, loc)
+
+	if !flows[0].Timestamp.Equal(ts) || !flows[0].EndTime.Equal(ts.Add(time.Minute)) {
+		t.Errorf("localizing changed the instant: %v", flows[0].Timestamp)
+	}
+	body, err := json.Marshal(flows[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"timestamp":"2025-01-15T12:30:00-05:00"`, `"endTime":"2025-01-15T12:31:00-05:00"`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("body %s does not contain %s", body, want)
+		}
+	}
+
+	rng := timeRangeJSON(ts.In(loc), ts.Add(time.Hour).In(loc))
+	if rng["start"] != "2025-01-15T12:30:00-05:00" || rng["end"] != "2025-01-15T13:30:00-05:00" {
+		t.Errorf("time range = %v, want New York offsets", rng)
+	}
+}
+
+func TestFlowEndpointsFetchDevicesOnce(t *testing.T) {
+	var deviceCalls atomic.Int32
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/devices":
+			deviceCalls.Add(1)
+			w.Write([]byte(`{"devices":[{"id":"1","name":"web","addresses":["100.64.0.1"]}]}`))
+		case "/api/v2/tailnet/example.com/logging/network":
+			w.Write([]byte(`{"logs":[{"nodeId":"n1","start":"2025-06-01T00:00:00Z","end":"2025-06-01T00:00:05Z","virtualTraffic":[
+				{"proto":6,"src":"100.64.0.1:443","dst":"100.64.0.2:5432","txBytes":10}
+			]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	router := gin.New()
+	router.GET("/api/summary", h.GetSummary)
+	router.GET("/api/devices/:deviceId", h.GetDevice)
+	router.GET("/api/devices/:deviceId/flows", h.GetDeviceFlows)
+	router.GET("/api/flows/ip/:ip", h.GetIPFlows)
+	router.GET("/api/flows/search", h.SearchFlows)
+	router.GET("/api/flows/sankey", h.GetFlowSankey)
+	router.GET("/api/flows/device-pairs", h.GetDevicePairs)
+	router.GET("/api/flows/ports-scan-detection", h.GetPortScans)
+	router.GET("/api/flows/unresolved", h.GetUnresolvedFlows)
+	router.GET("/api/exit-nodes/traffic", h.GetExitNodeTraffic)
+
+	requests := []string{
+		"/api/summary",
+		"/api/devices/1",
+		"/api/devices/1/flows?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+		"/api/flows/ip/100.64.0.1?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+		"/api/flows/search?q=web&start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+		"/api/flows/sankey?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+		"/api/flows/device-pairs?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+		"/api/flows/ports-scan-detection?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+		"/api/flows/unresolved?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+		"/api/exit-nodes/traffic?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z",
+	}
+	for _, target := range requests {
+		deviceCalls.Store(0)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", target, w.Code, w.Body)
+			continue
+		}
+		if n := deviceCalls.Load(); n != 1 {
+			t.Errorf("%s fetched the device list %d times, want once", target, n)
+		}
+	}
+}
+
+func TestParseFlowFiltersPackets(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantMin int64
+		wantMax int64
+		wantErr bool
+	}{
+		{"", 0, 0, false},
+		{"minPackets=50", 50, 0, false},
+		{"minPackets=50&maxPackets=200", 50, 200, false},
+		{"minPackets=-1", 0, 0, true},
+		{"maxPackets=lots", 0, 0, true},
+		{"minPackets=200&maxPackets=50", 0, 0, true},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/protocols?"+tt.query, nil)
+		filter, err := parseFlowFilters(c)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (filter.MinPackets != tt.wantMin || filter.MaxPackets != tt.wantMax) {
+			t.Errorf("%q: packets %d..%d, want %d..%d", tt.query, filter.MinPackets, filter.MaxPackets, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestParseFlowFiltersCIDRs(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantSrc []string
+		wantDst []string
+		wantErr string
+	}{
+		{"srcCidr=10.0.0.0/8", []string{"10.0.0.0/8"}, nil, ""},
+		{"dstCidr=10.0.1.7/24,+fd7a:115c:a1e0::/48", nil, []string{"10.0.1.0/24", "fd7a:115c:a1e0::/48"}, ""},
+		{"srcCidr=10.0.0.0/8,10.0.0.300/8", nil, nil, `"10.0.0.300/8"`},
+		{"dstCidr=10.0.0.1", nil, nil, `"10.0.0.1"`},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/protocols?"+tt.query, nil)
+		filter, err := parseFlowFilters(c)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: err = %v, want it to name %s", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if got := fmt.Sprint(filter.SourceCIDRs); got != fmt.Sprint(prefixList(tt.wantSrc)) {
+			t.Errorf("%q: srcCidr %s, want %v", tt.query, got, tt.wantSrc)
+		}
+		if got := fmt.Sprint(filter.DestCIDRs); got != fmt.Sprint(prefixList(tt.wantDst)) {
+			t.Errorf("%q: dstCidr %s, want %v", tt.query, got, tt.wantDst)
+		}
+	}
+}
+
+func prefixList(cidrs []string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, cidr := range cidrs {
+		out = append(out, netip.MustParsePrefix(cidr))
+	}
+	return out
+}
+
+func TestParseFlowFiltersDirections(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"directions=", nil},
+		{"directions=Inbound,+OUTBOUND", []string{"inbound", "outbound"}},
+		{"directions=sideways", []string{"sideways"}},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/protocols?"+tt.query, nil)
+		filter, err := parseFlowFilters(c)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if len(filter.Directions) != len(tt.want) {
+			t.Errorf("%q: directions %v, want %v", tt.query, filter.Directions, tt.want)
+		}
+		for _, d := range tt.want {
+			if !filter.Directions[d] {
+				t.Errorf("%q: directions %v, want %v", tt.query, filter.Directions, tt.want)
+			}
+		}
+	}
+}
+
+func TestFlowsFilteredByTag(t *testing.T) {
+	var deviceCalls atomic.Int32
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/devices":
+			deviceCalls.Add(1)
+			w.Write([]byte(`{"devices":[
+				{"id":"1","name":"web","addresses":["100.64.0.1"],"tags":["tag:server"]},
+				{"id":"2","name":"laptop","addresses":["100.64.0.2"],"user":"alice@example.com"}
+			]}`))
+		case "/api/v2/tailnet/example.com/logging/network":
+			w.Write([]byte(`{"logs":[{"nodeId":"n1","start":"2025-06-01T00:00:00Z","end":"2025-06-01T00:00:05Z","virtualTraffic":[
+				{"proto":6,"src":"100.64.0.2:50000","dst":"100.64.0.1:443","txBytes":10},
+				{"proto":17,"src":"100.64.0.2:50001","dst":"100.64.0.9:53","txBytes":10}
+			]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	tests := []struct {
+		query     string
+		wantFlows int
+	}{
+		{"tags=server", 1},
+		{"tags=tag:server", 1},
+		{"users=Alice@example.com", 2},
+		{"tags=tag:db", 0},
+	}
+	for _, tt := range tests {
+		deviceCalls.Store(0)
+		req := httptest.NewRequest(http.MethodGet, "/api/protocols?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z&"+tt.query, nil)
+		w := serve(h.GetProtocols, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tt.query, w.Code, w.Body)
+		}
+		var body struct {
+			TotalFlows int `json:"totalFlows"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.TotalFlows != tt.wantFlows {
+			t.Errorf("%s: %d flows, want %d", tt.query, body.TotalFlows, tt.wantFlows)
+		}
+		if n := deviceCalls.Load(); n != 1 {
+			t.Errorf("%s: fetched the device list %d times, want once", tt.query, n)
+		}
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandlers(nil, nil)
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantWarnings []string
+		check        func(t *testing.T, filters map[string]interface{}, limit int)
+	}{
+		{
+			name:       "clean filters",
+			query:      "ports=443,22&protocols=TCP&minBytes=10",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, filters map[string]interface{}, limit int) {
+				if fmt.Sprint(filters["ports"]) != "[22 443]" || fmt.Sprint(filters["protocols"]) != "[tcp]" || filters["minBytes"] != float64(10) {
+					t.Errorf("filters = %v", filters)
+				}
+				if limit != defaultFlowSearchLimit {
+					t.Errorf("limit = %d, want %d", limit, defaultFlowSearchLimit)
+				}
+			},
+		},
+		{
+			name:       "coerced values",
+			query:      "ports=080&tags=server&srcCidr=10.0.1.7/24&limit=50000",
+			wantStatus: http.StatusOK,
+			wantWarnings: []string{
+				`port "080" read as 80`,
+				`tag "server" read as "tag:server"`,
+				`srcCidr "10.0.1.7/24" read as 10.0.1.0/24`,
+				"limit 50000 clamped to 10000",
+			},
+			check: func(t *testing.T, filters map[string]interface{}, limit int) {
+				if fmt.Sprint(filters["ports"]) != "[80]" || fmt.Sprint(filters["tags"]) != "[tag:server]" || fmt.Sprint(filters["srcCidr"]) != "[10.0.1.0/24]" {
+					t.Errorf("filters = %v", filters)
+				}
+				if limit != maxFlowSearchLimit {
+					t.Errorf("limit = %d, want %d", limit, maxFlowSearchLimit)
+				}
+			},
+		},
+		{
+			name:       "values that match nothing",
+			query:      "protocols=tcpp&directions=sideways",
+			wantStatus: http.StatusOK,
+			wantWarnings: []string{
+				`protocol "tcpp" is not a known protocol and matches no flows`,
+				`direction "sideways" is not outbound, inbound or bidirectional and matches no flows`,
+			},
+		},
+		{name: "non-numeric bound", query: "minBytes=lots", wantStatus: http.StatusBadRequest},
+		{name: "bad limit", query: "limit=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h.ValidateFilters, httptest.NewRequest(http.MethodGet, "/api/filters/validate?"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Filters  map[string]interface{} `json:"filters"`
+				Limit    int                    `json:"limit"`
+				Warnings []string               `json:"warnings"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Warnings == nil {
+				t.Error("warnings is null, want a list")
+			}
+			if strings.Join(body.Warnings, "\n") != strings.Join(tt.wantWarnings, "\n") {
+				t.Errorf("warnings = %q, want %q", body.Warnings, tt.wantWarnings)
+			}
+			if tt.check != nil {
+				tt.check(t, body.Filters, body.Limit)
+			}
+		})
+	}
+}
+
+func TestGetTopTalkers(t *testing.T) {
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/devices":
+			w.Write([]byte(`{"devices":[{"id":"1","name":"web","addresses":["100.64.0.1"]}]}`))
+		case "/api/v2/tailnet/example.com/logging/network":
+			w.Write([]byte(`{"logs":[{"nodeId":"n1","start":"2025-06-01T00:00:00Z","end":"2025-06-01T00:00:05Z","virtualTraffic":[
+				{"proto":6,"src":"100.64.0.1:443","dst":"100.64.0.2:5432","txBytes":10,"rxBytes":20}
+			]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	tests := []struct {
+		query       string
+		wantStatus  int
+		wantTalkers int
+	}{
+		{"start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z", http.StatusOK, 2},
+		{"start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z&top=1", http.StatusOK, 1},
+		{"start=2025-06-01T00:00:00Z&end=2025-06-08T00:00:00Z", http.StatusOK, 2},
+		{"start=2025-06-01T00:00:00Z&end=2025-06-08T00:00:01Z", http.StatusBadRequest, 0},
+		{"top=0", http.StatusBadRequest, 0},
+		{"start=yesterday&end=today", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := serve(h.GetTopTalkers, httptest.NewRequest(http.MethodGet, "/api/top-talkers?"+tt.query, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", tt.query, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Talkers []services.TalkerStat `json:"talkers"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Talkers) != tt.wantTalkers {
+			t.Errorf("%s: %d talkers, want %d", tt.query, len(body.Talkers), tt.wantTalkers)
+		}
+		if body.Talkers[0].ID != "1" || body.Talkers[0].TxBytes != 10 || body.Talkers[0].RxBytes != 20 {
+			t.Errorf("%s: first talker %+v, want device 1 with 10 tx and 20 rx bytes", tt.query, body.Talkers[0])
+		}
+	}
+}
+
+func TestGetFlowTimeSeries(t *testing.T) {
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/devices":
+			w.Write([]byte(`{"devices":[]}`))
+		case "/api/v2/tailnet/example.com/logging/network":
+			w.Write([]byte(`{"logs":[{"nodeId":"n1","start":"2025-06-01T00:00:10Z","end":"2025-06-01T00:00:15Z","virtualTraffic":[
+				{"proto":6,"src":"100.64.0.1:443","dst":"100.64.0.2:5432","txBytes":10,"rxBytes":20}
+			]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	tests := []struct {
+		query       string
+		wantStatus  int
+		wantBuckets int
+	}{
+		{"start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z", http.StatusOK, 60},
+		{"start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z&interval=5m", http.StatusOK, 12},
+		{"start=2025-06-01T00:00:00Z&end=2025-06-02T09:20:00Z", http.StatusOK, 2000},
+		{"start=2025-06-01T00:00:00Z&end=2025-06-02T09:21:00Z", http.StatusBadRequest, 0},
+		{"interval=0s", http.StatusBadRequest, 0},
+		{"interval=soon", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := serve(h.GetFlowTimeSeries, httptest.NewRequest(http.MethodGet, "/api/flow-timeseries?"+tt.query, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", tt.query, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Buckets []services.TimeBucket `json:"buckets"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Buckets) != tt.wantBuckets {
+			t.Errorf("%s: %d buckets, want %d", tt.query, len(body.Buckets), tt.wantBuckets)
+			continue
+		}
+		if body.Buckets[0].TotalBytes != 30 || body.Buckets[0].FlowCount != 1 {
+			t.Errorf("%s: first bucket = %+v, want the one flow", tt.query, body.Buckets[0])
+		}
+	}
+}
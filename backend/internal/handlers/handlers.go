@@ -1,22 +1,37 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/config"
 	"github.com/rajsinghtech/tsflow/backend/internal/services"
-	tailscale "tailscale.com/client/tailscale/v2"
+	"github.com/rajsinghtech/tsflow/backend/internal/utils"
 )
 
 type Handlers struct {
 	tailscaleService *services.TailscaleService
+	cfg              *config.Config
+	cache            ttlCache
+	ready            readinessCache
+	streamPoll       flowPoll
 }
 
-func NewHandlers(tailscaleService *services.TailscaleService) *Handlers {
+func NewHandlers(tailscaleService *services.TailscaleService, cfg *config.Config) *Handlers {
 	return &Handlers{
 		tailscaleService: tailscaleService,
+		cfg:              cfg,
 	}
 }
 
@@ -28,11 +43,62 @@ func (h *Handlers) HealthCheck(c *gin.Context) {
 	})
 }
 
+const (
+	// readinessTTL is how long a readiness result is reused, so frequent
+	// probes don't each call the Tailscale API
+	readinessTTL = 5 * time.Second
+	// readinessTimeout bounds the upstream call made by a readiness check
+	readinessTimeout = 3 * time.Second
+)
+
+// readinessCache holds the outcome of the last upstream connectivity check
+type readinessCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// ReadinessCheck reports 200 only when the Tailscale API accepts our
+// credentials, and 503 with the failure reason otherwise
+func (h *Handlers) ReadinessCheck(c *gin.Context) {
+	h.ready.mu.Lock()
+	checked, err := h.ready.checked, h.ready.err
+	if time.Since(checked) > readinessTTL {
+		// The result is shared by every prober, so it must not depend on
+		// whether this particular caller is still connected
+		ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+		checked, err = time.Now(), h.tailscaleService.CheckConnectivity(ctx)
+		cancel()
+		// A cancelled probe says nothing about the upstream
+		if !errors.Is(err, context.Canceled) {
+			h.ready.checked, h.ready.err = checked, err
+		}
+		if err != nil {
+			log.Printf("WARNING readiness check failed: %v", err)
+		}
+	}
+	h.ready.mu.Unlock()
+
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":    "unavailable",
+			"message":   err.Error(),
+			"checkedAt": checked.UTC(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "ready",
+		"checkedAt": checked.UTC(),
+	})
+}
+
 func (h *Handlers) GetDevices(c *gin.Context) {
-	devices, err := h.tailscaleService.GetDevices()
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
 	if err != nil {
-		log.Printf("ERROR GetDevices failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		log.Printf("%sERROR GetDevices failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
 			"error":   "Failed to fetch devices",
 			"message": err.Error(),
 		})
@@ -43,27 +109,259 @@ func (h *Handlers) GetDevices(c *gin.Context) {
 	c.JSON(http.StatusOK, devices)
 }
 
+// GetDeviceStats counts devices by OS, client version, status and pending updates
+func (h *Handlers) GetDeviceStats(c *gin.Context) {
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetDeviceStats failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	stats := services.SummarizeDevices(devices.Devices)
+
+	log.Printf("SUCCESS GetDeviceStats: summarized %d devices", stats.Total)
+	c.JSON(http.StatusOK, stats)
+}
+
+// deviceDetailTTL is how long a device detail response is reused
+const deviceDetailTTL = 30 * time.Second
+
+// GetDevice returns one device with its traffic totals over the last hour
+func (h *Handlers) GetDevice(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	cacheKey := "device:" + deviceID
+	if body, ok := h.cache.get(cacheKey); ok {
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	var device *services.Device
+	if err == nil {
+		device, err = services.FindDevice(devices.Devices, deviceID)
+	}
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		errorJSON(c, http.StatusNotFound, gin.H{
+			"error": "Device not found",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("%sERROR GetDevice failed for device %s: %v", utils.LogPrefix(c.Request.Context()), deviceID, err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch device",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	end := time.Now()
+	start := end.Add(-defaultFlowWindow)
+	flows, err := h.tailscaleService.GetRawFlowsWithDevices(c.Request.Context(), start, end, devices.Devices)
+	if err != nil {
+		log.Printf("%sERROR GetDevice failed for device %s: %v", utils.LogPrefix(c.Request.Context()), deviceID, err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch network flows",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	body := gin.H{
+		"device":    device,
+		"stats":     services.SummarizeDeviceTraffic(*device, flows),
+		"timeRange": timeRangeJSON(start, end),
+	}
+	h.cache.set(cacheKey, body, deviceDetailTTL)
+
+	log.Printf("SUCCESS GetDevice: returned device %s", deviceID)
+	c.JSON(http.StatusOK, body)
+}
+
+// staleDevice is a device together with how long ago it was last seen
+type staleDevice struct {
+	services.Device
+	DaysSinceLastSeen int `json:"daysSinceLastSeen"`
+
+	sinceLastSeen time.Duration
+}
+
+// GetStaleDevices lists devices not seen within the last ?days= days (default 30),
+// most stale first. Devices without a usable LastSeen are reported separately.
+func (h *Handlers) GetStaleDevices(c *gin.Context) {
+	days := 30
+	if d, err := strconv.Atoi(c.Query("days")); err == nil && d > 0 {
+		days = d
+	}
+	threshold := time.Duration(days) * 24 * time.Hour
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetStaleDevices failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	stale := []staleDevice{}
+	unknownLastSeen := []services.Device{}
+	for _, device := range devices.Devices {
+		lastSeen, err := time.Parse(time.RFC3339, device.LastSeen)
+		if err != nil || lastSeen.IsZero() {
+			unknownLastSeen = append(unknownLastSeen, device)
+			continue
+		}
+
+		since := now.Sub(lastSeen)
+		if since >= threshold {
+			stale = append(stale, staleDevice{
+				Device:            device,
+				DaysSinceLastSeen: int(since.Hours() / 24),
+				sinceLastSeen:     since,
+			})
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].sinceLastSeen > stale[j].sinceLastSeen
+	})
+
+	log.Printf("SUCCESS GetStaleDevices: %d stale, %d with unknown last seen", len(stale), len(unknownLastSeen))
+	c.JSON(http.StatusOK, gin.H{
+		"days":            days,
+		"devices":         stale,
+		"unknownLastSeen": unknownLastSeen,
+		"totalStale":      len(stale) + len(unknownLastSeen),
+	})
+}
+
+const (
+	defaultDeviceSearchLimit = 50
+	maxDeviceSearchLimit     = 500
+)
+
+// SearchDevices matches ?q= against device names, hostnames, users, addresses
+// and tags, returning at most ?limit= devices
+func (h *Handlers) SearchDevices(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "missing query",
+			"message": "q is required",
+		})
+		return
+	}
+
+	limit := defaultDeviceSearchLimit
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid limit",
+				"message": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = min(n, maxDeviceSearchLimit)
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR SearchDevices failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	matches := services.FilterDevices(devices.Devices, q)
+	total := len(matches)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	log.Printf("SUCCESS SearchDevices: %d of %d matches for %q", len(matches), total, q)
+	c.JSON(http.StatusOK, gin.H{
+		"query":        q,
+		"devices":      matches,
+		"totalMatches": total,
+		"truncated":    total > len(matches),
+	})
+}
+
+// parseInclude parses a comma-separated ?include= list against the allowed
+// section names. An absent or empty list includes every section.
+func parseInclude(c *gin.Context, allowed ...string) (map[string]bool, error) {
+	include := make(map[string]bool, len(allowed))
+	raw := strings.TrimSpace(c.Query("include"))
+	if raw == "" {
+		for _, name := range allowed {
+			include[name] = true
+		}
+		return include, nil
+	}
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		valid := false
+		for _, a := range allowed {
+			if name == a {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown include %q, expected one of %s", name, strings.Join(allowed, ", "))
+		}
+		include[name] = true
+	}
+	return include, nil
+}
+
 func (h *Handlers) GetServicesAndRecords(c *gin.Context) {
-	// Fetch VIP services
-	vipServices, servicesErr := h.tailscaleService.GetVIPServices()
-	if servicesErr != nil {
-		log.Printf("WARNING GetVIPServices failed: %v", servicesErr)
-		vipServices = make(map[string]services.VIPServiceInfo)
-	}
-	
-	// Fetch static records
-	staticRecords, recordsErr := h.tailscaleService.GetStaticRecords()
-	if recordsErr != nil {
-		log.Printf("WARNING GetStaticRecords failed: %v", recordsErr)
-		staticRecords = make(map[string]services.StaticRecordInfo)
-	}
-	
-	response := gin.H{
-		"services": vipServices,
-		"records":  staticRecords,
-	}
-	
-	log.Printf("SUCCESS GetServicesAndRecords: returned %d services and %d records", len(vipServices), len(staticRecords))
+	include, err := parseInclude(c, "services", "records")
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid include",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{}
+	serviceCount, recordCount := 0, 0
+
+	if include["services"] {
+		// Fetch VIP services
+		vipServices, servicesErr := h.tailscaleService.GetVIPServices(c.Request.Context())
+		if servicesErr != nil {
+			log.Printf("WARNING GetVIPServices failed: %v", servicesErr)
+			vipServices = make(map[string]services.VIPServiceInfo)
+		}
+		response["services"] = vipServices
+		serviceCount = len(vipServices)
+	}
+
+	if include["records"] {
+		// Fetch static records
+		staticRecords, recordsErr := h.tailscaleService.GetStaticRecords(c.Request.Context())
+		if recordsErr != nil {
+			log.Printf("WARNING GetStaticRecords failed: %v", recordsErr)
+			staticRecords = make(map[string]services.StaticRecordInfo)
+		}
+		response["records"] = staticRecords
+		recordCount = len(staticRecords)
+	}
+
+	log.Printf("SUCCESS GetServicesAndRecords: returned %d services and %d records", serviceCount, recordCount)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -72,15 +370,26 @@ func (h *Handlers) GetNetworkLogs(c *gin.Context) {
 	end := c.Query("end")
 
 	if start == "" || end == "" {
+		window := 5 * time.Minute
+		if rng := c.Query("range"); rng != "" {
+			d, err := parseRelativeRange(rng)
+			if err != nil {
+				log.Printf("ERROR GetNetworkLogs: %v", err)
+				errorJSON(c, http.StatusBadRequest, gin.H{"error": "bad range", "message": err.Error()})
+				return
+			}
+			window = d
+		}
+
 		now := time.Now()
-		start = now.Add(-5 * time.Minute).Format(time.RFC3339)
+		start = now.Add(-window).Format(time.RFC3339)
 		end = now.Format(time.RFC3339)
 	}
 
 	st, err := time.Parse(time.RFC3339, start)
 	if err != nil {
 		log.Printf("ERROR GetNetworkLogs: invalid start time %s: %v", start, err)
-		c.JSON(http.StatusBadRequest, gin.H{
+		errorJSON(c, http.StatusBadRequest, gin.H{
 			"error":   "bad start time",
 			"message": err.Error(),
 		})
@@ -90,32 +399,64 @@ func (h *Handlers) GetNetworkLogs(c *gin.Context) {
 	et, err := time.Parse(time.RFC3339, end)
 	if err != nil {
 		log.Printf("ERROR GetNetworkLogs: invalid end time %s: %v", end, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "bad end time", "message": err.Error()})
+		errorJSON(c, http.StatusBadRequest, gin.H{"error": "bad end time", "message": err.Error()})
 		return
 	}
 
 	if et.Before(st) {
 		log.Printf("ERROR GetNetworkLogs: end time before start time: %s < %s", end, start)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "end time before start time"})
+		errorJSON(c, http.StatusBadRequest, gin.H{"error": "end time before start time"})
 		return
 	}
 
 	now := time.Now()
 	if st.After(now) {
 		log.Printf("ERROR GetNetworkLogs: future start time not allowed: %s", start)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "future start time not allowed"})
+		errorJSON(c, http.StatusBadRequest, gin.H{"error": "future start time not allowed"})
 		return
 	}
 
 	duration := et.Sub(st)
+
+	// Logs are filtered to matching traffic records only when a filter is
+	// given; ?raw=true always returns the upstream logs untouched
+	filter, err := parseFlowFilters(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{"error": "invalid filter", "message": err.Error()})
+		return
+	}
+	if raw, _ := strconv.ParseBool(c.Query("raw")); raw {
+		filter = services.FlowFilter{}
+	}
+	if filter.NeedsDevices() {
+		devices, ok := h.filterDevices(c, "GetNetworkLogs")
+		if !ok {
+			return
+		}
+		filter.SetDevices(devices)
+	}
+
+	// ?sample=false answers 413 rather than truncating or sampling chunked logs
+	sample := true
+	if raw := c.Query("sample"); raw != "" {
+		sample, err = strconv.ParseBool(raw)
+		if err != nil {
+			errorJSON(c, http.StatusBadRequest, gin.H{"error": "invalid sample", "message": "sample must be true or false"})
+			return
+		}
+	}
+
+	if wantsNDJSON(c) {
+		h.streamNetworkLogs(c, st, et, filter)
+		return
+	}
+
 	// Use chunking for queries longer than 7 days to prevent response size issues
 	if duration > 7*24*time.Hour {
-		// Use smaller chunks and fewer parallel requests for 30+ day queries
-		chunkSize := 24 * time.Hour // 1-day chunks to prevent timeouts
-		maxParallel := 2            // Reduce parallel requests to prevent memory issues
-		chunks, err := h.tailscaleService.GetNetworkLogsChunkedParallel(start, end, chunkSize, maxParallel)
+		chunkSize, maxParallel := h.logChunking(c)
+		chunks, err := h.tailscaleService.GetNetworkLogsChunkedParallel(c.Request.Context(), start, end, chunkSize, maxParallel)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
+			errorJSON(c, upstreamStatus(err), gin.H{
 				"error":   "Failed to fetch network logs",
 				"message": err.Error(),
 				"hint":    "Try selecting a smaller time range",
@@ -123,82 +464,340 @@ func (h *Handlers) GetNetworkLogs(c *gin.Context) {
 			return
 		}
 
-		var allLogs []interface{}
-		maxLogs := 10000 // Limit total logs to prevent memory issues
-		
-		for _, chunk := range chunks {
-			if logsArray, ok := chunk.([]interface{}); ok {
-				if len(allLogs)+len(logsArray) > maxLogs {
-					// Truncate if we're approaching the limit
-					remaining := maxLogs - len(allLogs)
-					if remaining > 0 {
-						allLogs = append(allLogs, logsArray[:remaining]...)
-					}
-					break
-				}
-				allLogs = append(allLogs, logsArray...)
-			} else if logsMap, ok := chunk.(map[string]interface{}); ok {
-				if logs, exists := logsMap["logs"]; exists {
-					if logsArray, ok := logs.([]interface{}); ok {
-						if len(allLogs)+len(logsArray) > maxLogs {
-							// Truncate if we're approaching the limit
-							remaining := maxLogs - len(allLogs)
-							if remaining > 0 {
-								allLogs = append(allLogs, logsArray[:remaining]...)
-							}
-							break
-						}
-						allLogs = append(allLogs, logsArray...)
-					} else if logsArray, ok := logs.([]tailscale.NetworkFlowLog); ok {
-						// Convert []NetworkFlowLog to []interface{}
-						for _, log := range logsArray {
-							allLogs = append(allLogs, log)
-						}
-					}
-				}
-			}
+		// Filtering happens per chunk, so the log limit counts matching logs only
+		maxLogs := h.cfg.MaxLogs // Limit total logs to prevent memory issues
+		allLogs, truncated, err := mergeChunkLogs(chunks, maxLogs, filter)
+		if err != nil {
+			log.Printf("ERROR GetNetworkLogs filter failed: %v", err)
+			errorJSON(c, http.StatusInternalServerError, gin.H{
+				"error":   "Failed to filter network logs",
+				"message": err.Error(),
+			})
+			return
 		}
-		
-		// If we have too many logs, sample them to prevent response size issues
-		finalLogs := allLogs
-		if len(allLogs) > 50000 {
-			// Sample every Nth log to get approximately 50,000 logs
-			sampleRate := len(allLogs) / 50000
-			if sampleRate < 1 {
-				sampleRate = 1
-			}
-			
-			sampledLogs := make([]interface{}, 0, 50000)
-			for i := 0; i < len(allLogs); i += sampleRate {
-				sampledLogs = append(sampledLogs, allLogs[i])
-			}
-			finalLogs = sampledLogs
+
+		if truncated && !sample {
+			log.Printf("WARNING GetNetworkLogs: more than %d logs between %s and %s", maxLogs, start, end)
+			errorJSON(c, http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Too many logs",
+				"message": fmt.Sprintf("more than %d logs in range (TSFLOW_MAX_LOGS)", maxLogs),
+				"hint":    "Try selecting a smaller time range",
+			})
+			return
 		}
-		
-		c.JSON(http.StatusOK, gin.H{
+
+		// Chunks are appended in index order, but a partially failed chunk can leave
+		// the merged logs out of order, so re-sort by each log's start time
+		sortLogsByStart(allLogs)
+
+		if !sample && len(allLogs) > h.cfg.SampleCeiling {
+			log.Printf("WARNING GetNetworkLogs: %d logs exceed the sample ceiling of %d", len(allLogs), h.cfg.SampleCeiling)
+			errorJSON(c, http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Too many logs",
+				"message": fmt.Sprintf("%d logs in range, over the %d log limit (TSFLOW_SAMPLE_CEILING)", len(allLogs), h.cfg.SampleCeiling),
+				"hint":    "Try selecting a smaller time range",
+			})
+			return
+		}
+
+		// If we have too many logs, sample them to prevent response size issues
+		finalLogs, sampleRate := sampleLogs(allLogs, h.cfg.SampleCeiling)
+
+		h.sizedJSON(c, gin.H{
 			"logs": finalLogs,
 			"metadata": gin.H{
 				"chunked":     true,
 				"chunks":      len(chunks),
 				"duration":    duration.String(),
 				"totalLogs":   len(allLogs),
-				"sampled":     len(finalLogs) < len(allLogs),
-				"sampleRate":  len(allLogs) / len(finalLogs),
+				"truncated":   truncated,
+				"sampled":     sampleRate > 1,
+				"sampleRate":  sampleRate,
 			},
 		})
 		return
 	}
 
-	logs, err := h.tailscaleService.GetNetworkLogs(start, end)
+	logs, err := h.tailscaleService.GetNetworkLogs(c.Request.Context(), start, end)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		errorJSON(c, upstreamStatus(err), gin.H{
 			"error":   "Failed to fetch network logs",
 			"message": err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, logs)
+	if !filter.IsZero() {
+		var upstreamLogs interface{}
+		if logsMap, ok := logs.(map[string]interface{}); ok {
+			upstreamLogs = logsMap["logs"]
+		}
+		filtered, err := services.FilterNetworkLogs(upstreamLogs, filter)
+		if err != nil {
+			log.Printf("ERROR GetNetworkLogs filter failed: %v", err)
+			errorJSON(c, http.StatusInternalServerError, gin.H{
+				"error":   "Failed to filter network logs",
+				"message": err.Error(),
+			})
+			return
+		}
+		logs = gin.H{"logs": filtered}
+	}
+
+	h.sizedJSON(c, logs)
+}
+
+// mergeChunkLogs concatenates the logs of each chunk in order, keeping only
+// the traffic matching filter, and stops at maxLogs. Each chunk is filtered
+// before it counts toward the limit. truncated reports whether any matching
+// logs were dropped to fit.
+func mergeChunkLogs(chunks []interface{}, maxLogs int, filter services.FlowFilter) (allLogs []interface{}, truncated bool, err error) {
+	for _, chunk := range chunks {
+		var logsArray []interface{}
+		if arr, ok := chunk.([]interface{}); ok {
+			logsArray = arr
+		} else if logsMap, ok := chunk.(map[string]interface{}); ok {
+			if logs, exists := logsMap["logs"]; exists {
+				if arr, ok := logs.([]interface{}); ok {
+					logsArray = arr
+				}
+			}
+		}
+
+		if !filter.IsZero() {
+			filtered, err := services.FilterNetworkLogs(logsArray, filter)
+			if err != nil {
+				return nil, false, err
+			}
+			logsArray = make([]interface{}, len(filtered))
+			for i, flowLog := range filtered {
+				logsArray[i] = flowLog
+			}
+		}
+
+		if len(allLogs)+len(logsArray) > maxLogs {
+			// Truncate at the limit
+			allLogs = append(allLogs, logsArray[:maxLogs-len(allLogs)]...)
+			return allLogs, true, nil
+		}
+		allLogs = append(allLogs, logsArray...)
+	}
+	return allLogs, false, nil
+}
+
+// sampleLogs keeps every sampleRate-th log so that at most ceiling remain,
+// returning the logs unchanged with a sampleRate of 1 when they already fit.
+// The result is never nil, so an empty range encodes as []. A ceiling below 1
+// disables sampling rather than dividing by zero.
+func sampleLogs(logs []interface{}, ceiling int) (sampled []interface{}, sampleRate int) {
+	if ceiling < 1 || len(logs) <= ceiling {
+		if logs == nil {
+			logs = []interface{}{}
+		}
+		return logs, 1
+	}
+
+	// Round the stride up; rounding down would keep more than ceiling logs
+	sampleRate = (len(logs) + ceiling - 1) / ceiling
+	sampled = make([]interface{}, 0, ceiling)
+	for i := 0; i < len(logs); i += sampleRate {
+		sampled = append(sampled, logs[i])
+	}
+	return sampled, sampleRate
+}
+
+// parseTimeRange reads the optional RFC3339 start/end query parameters. When neither
+// is given, it uses the relative ?range= (e.g. 6h, 2d) or else defaultWindow, ending now.
+func parseTimeRange(c *gin.Context, defaultWindow time.Duration) (time.Time, time.Time, error) {
+	start := c.Query("start")
+	end := c.Query("end")
+
+	if start == "" && end == "" {
+		window := defaultWindow
+		if rng := c.Query("range"); rng != "" {
+			d, err := parseRelativeRange(rng)
+			if err != nil {
+				return time.Time{}, time.Time{}, err
+			}
+			window = d
+		}
+		now := time.Now().UTC()
+		return now.Add(-window), now, nil
+	}
+	if start == "" || end == "" {
+		return time.Time{}, time.Time{}, errors.New("start and end must be provided together")
+	}
+
+	st, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("bad start time: %w", err)
+	}
+	et, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("bad end time: %w", err)
+	}
+	if et.Before(st) {
+		return time.Time{}, time.Time{}, errors.New("end time before start time")
+	}
+	return st, et, nil
+}
+
+// parseTimeZone reads the optional IANA ?tz= zone (e.g. America/New_York) used
+// to display timestamps, defaulting to UTC. It never affects which flows match.
+func parseTimeZone(c *gin.Context) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	// "Local" would leak the server's zone and differ between deployments
+	if tz == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", tz)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", tz)
+	}
+	return loc, nil
+}
+
+// sortLogsByStart orders network logs by start time, keeping the relative
+// order of logs that start together
+func sortLogsByStart(logs []interface{}) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logStartTime(logs[i]).Before(logStartTime(logs[j]))
+	})
+}
+
+// logStartTime extracts the start time from a network log, which is a
+// generic map decoded from the API, or a services.FlowLog once filtered. Logs without a usable start time sort
+// first.
+func logStartTime(entry interface{}) time.Time {
+	switch l := entry.(type) {
+	case services.FlowLog:
+		return l.Start
+	case map[string]interface{}:
+		if start, ok := l["start"].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, start); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// parseRelativeRange parses a lookback window given as a Go duration ("90m", "6h")
+// or a whole number of days ("2d")
+func parseRelativeRange(rng string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(rng, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q: use a duration like 6h or a day count like 2d", rng)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(rng)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q: use a duration like 6h or a day count like 2d", rng)
+		}
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid range %q: must be positive", rng)
+	}
+	return d, nil
+}
+
+// logChunking returns the chunk size and parallelism for a chunked network log
+// fetch: the configured values, overridden by ?chunkSize= and ?concurrency=.
+// Invalid or out-of-range overrides are ignored with a warning.
+func (h *Handlers) logChunking(c *gin.Context) (time.Duration, int) {
+	chunkSize, maxParallel := h.cfg.LogChunkSize, h.cfg.LogMaxParallel
+
+	if raw := c.Query("chunkSize"); raw != "" {
+		d, err := parseRelativeRange(raw)
+		if err != nil || d < config.MinLogChunkSize || d > config.MaxLogChunkSize {
+			log.Printf("WARNING ignoring chunkSize %q, must be between %s and %s", raw, config.MinLogChunkSize, config.MaxLogChunkSize)
+		} else {
+			chunkSize = d
+		}
+	}
+
+	if raw := c.Query("concurrency"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > config.MaxLogParallel {
+			log.Printf("WARNING ignoring concurrency %q, must be between 1 and %d", raw, config.MaxLogParallel)
+		} else {
+			maxParallel = n
+		}
+	}
+
+	return chunkSize, maxParallel
+}
+
+// wantsNDJSON reports whether the client asked for newline-delimited JSON streaming
+func wantsNDJSON(c *gin.Context) bool {
+	return c.Query("stream") == "ndjson" || strings.Contains(c.GetHeader("Accept"), "application/x-ndjson")
+}
+
+// streamNetworkLogs writes one network log object per line as chunks arrive from the
+// upstream API, flushing after each line so large ranges never sit in memory.
+func (h *Handlers) streamNetworkLogs(c *gin.Context, start, end time.Time, filter services.FlowFilter) {
+	chunkSize := end.Sub(start)
+	maxParallel := 1
+	if chunkSize > 7*24*time.Hour {
+		chunkSize, maxParallel = h.logChunking(c)
+	}
+
+	encoder := json.NewEncoder(c.Writer)
+	written := 0
+
+	// The request context is cancelled when the client disconnects
+	err := h.tailscaleService.StreamNetworkLogs(c.Request.Context(), start, end, chunkSize, maxParallel, func(entry interface{}) error {
+		if !filter.IsZero() {
+			filtered, err := services.FilterNetworkLogs([]interface{}{entry}, filter)
+			if err != nil {
+				return err
+			}
+			if len(filtered) == 0 {
+				return nil
+			}
+			entry = filtered[0]
+		}
+		if written == 0 {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		written++
+		return nil
+	})
+
+	if err != nil {
+		if written == 0 {
+			log.Printf("%sERROR GetNetworkLogs stream failed: %v", utils.LogPrefix(c.Request.Context()), err)
+			errorJSON(c, upstreamStatus(err), gin.H{
+				"error":   "Failed to fetch network logs",
+				"message": err.Error(),
+			})
+			return
+		}
+		// Headers are already sent; all we can do is end the stream early
+		log.Printf("ERROR GetNetworkLogs stream aborted after %d logs: %v", written, err)
+		return
+	}
+
+	if written == 0 {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+	}
+
+	log.Printf("SUCCESS GetNetworkLogs: streamed %d logs", written)
 }
 
 // Helper function to get map keys
@@ -211,10 +810,10 @@ func getMapKeys(m map[string]interface{}) []string {
 }
 
 func (h *Handlers) GetNetworkMap(c *gin.Context) {
-	networkMap, err := h.tailscaleService.GetNetworkMap()
+	networkMap, err := h.tailscaleService.GetNetworkMap(c.Request.Context())
 	if err != nil {
-		log.Printf("ERROR GetNetworkMap failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		log.Printf("%sERROR GetNetworkMap failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
 			"error":   "Failed to fetch network map",
 			"message": err.Error(),
 		})
@@ -222,36 +821,134 @@ func (h *Handlers) GetNetworkMap(c *gin.Context) {
 	}
 
 	log.Printf("SUCCESS GetNetworkMap: returned network map")
-	c.JSON(http.StatusOK, networkMap)
+	h.jsonWithETag(c, networkMap)
 }
 
 func (h *Handlers) GetDeviceFlows(c *gin.Context) {
 	deviceID := c.Param("deviceId")
 	if deviceID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
+		errorJSON(c, http.StatusBadRequest, gin.H{
 			"error": "Device ID is required",
 		})
 		return
 	}
 
-	flows, err := h.tailscaleService.GetDeviceFlows(deviceID)
+	start, end, err := parseTimeRange(c, defaultFlowWindow)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid time range",
+			"message": err.Error(),
+		})
+		return
+	}
+	loc, err := parseTimeZone(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid tz",
+			"message": err.Error(),
+		})
+		return
+	}
+	humanize, err := parseHumanize(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid humanize",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, err := h.tailscaleService.GetDeviceFlows(c.Request.Context(), deviceID, start.In(loc), end.In(loc))
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		errorJSON(c, http.StatusNotFound, gin.H{
+			"error": "Device not found",
+		})
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR GetDeviceFlows failed for device %s: %v", deviceID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		log.Printf("%sERROR GetDeviceFlows failed for device %s: %v", utils.LogPrefix(c.Request.Context()), deviceID, err)
+		errorJSON(c, upstreamStatus(err), gin.H{
 			"error":   "Failed to fetch device flows",
 			"message": err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, flows)
+	if deviceFlows, ok := flows["flows"].([]services.RawFlowEntry); ok {
+		localizeFlows(deviceFlows, loc)
+		if humanize {
+			services.HumanizeBytes(deviceFlows)
+		}
+	}
+	h.jsonWithETag(c, flows)
+}
+
+// GetIPFlows returns the flows to or from one IP, for addresses known only by
+// IP such as unmanaged hosts behind a subnet router. IPv6 addresses may be
+// URL-encoded or bracketed in the path.
+func (h *Handlers) GetIPFlows(c *gin.Context) {
+	raw := strings.Trim(c.Param("ip"), "[]")
+	parsed, err := netip.ParseAddr(raw)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid ip",
+			"message": fmt.Sprintf("%q is not an IP address", raw),
+		})
+		return
+	}
+	// Flow addresses are canonical and zoneless, and IPv4 flows are logged as
+	// plain IPv4, so ::ffff:a.b.c.d must match them too
+	ip := parsed.Unmap().WithZone("")
+
+	start, end, err := parseTimeRange(c, defaultFlowWindow)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid time range",
+			"message": err.Error(),
+		})
+		return
+	}
+	loc, err := parseTimeZone(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid tz",
+			"message": err.Error(),
+		})
+		return
+	}
+	humanize, err := parseHumanize(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid humanize",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, err := h.tailscaleService.GetIPFlows(c.Request.Context(), ip, start.In(loc), end.In(loc))
+	if err != nil {
+		log.Printf("%sERROR GetIPFlows failed for %s: %v", utils.LogPrefix(c.Request.Context()), ip, err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch IP flows",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if ipFlows, ok := flows["flows"].([]services.RawFlowEntry); ok {
+		localizeFlows(ipFlows, loc)
+		if humanize {
+			services.HumanizeBytes(ipFlows)
+		}
+	}
+	h.jsonWithETag(c, flows)
 }
 
 func (h *Handlers) GetDNSNameservers(c *gin.Context) {
-	nameservers, err := h.tailscaleService.GetDNSNameservers()
+	nameservers, err := h.tailscaleService.GetDNSNameservers(c.Request.Context())
 	if err != nil {
-		log.Printf("ERROR GetDNSNameservers failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		log.Printf("%sERROR GetDNSNameservers failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
 			"error":   "Failed to fetch DNS nameservers",
 			"message": err.Error(),
 		})
@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/config"
+	"github.com/rajsinghtech/tsflow/backend/internal/services"
+	"github.com/rajsinghtech/tsflow/backend/internal/utils"
+)
+
+// newTestHandlers returns handlers backed by a service that calls upstream as
+// its Tailscale API
+func newTestHandlers(t *testing.T, upstream http.Handler) *Handlers {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{
+		TailscaleAPIKey:         "tskey-api-test",
+		TailscaleTailnet:        "example.com",
+		TailscaleAPIURL:         srv.URL,
+		UpstreamTimeout:         5 * time.Second,
+		UpstreamMaxIdleConns:    4,
+		UpstreamMaxConns:        8,
+		UpstreamIdleConnTimeout: time.Minute,
+		OnlineThreshold:         2 * time.Minute,
+		LogChunkSize:            24 * time.Hour,
+		LogMaxParallel:          2,
+		MaxLogs:                 100000,
+		SampleCeiling:           50000,
+	}
+	return NewHandlers(services.NewTailscaleService(cfg), cfg)
+}
+
+// serve runs handler for one request and returns the recorded response
+func serve(handler gin.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	handler(c)
+	return w
+}
+
+func TestSortLogsByStart(t *testing.T) {
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+
+	// Three day-long chunks, each already in order, in the orders chunks can
+	// complete in; element types differ by fetch path
+	chunks := [][]interface{}{
+		{map[string]interface{}{"start": at(0).Format(time.RFC3339)}, map[string]interface{}{"start": at(12).Format(time.RFC3339)}},
+		{map[string]interface{}{"start": at(24).Format(time.RFC3339Nano)}, map[string]interface{}{"start": at(36).Format(time.RFC3339Nano)}},
+		{services.FlowLog{Start: at(48)}, services.FlowLog{Start: at(60)}},
+	}
+	orders := [][]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}, {2, 0, 1}}
+
+	for _, order := range orders {
+		var logs []interface{}
+		for _, i := range order {
+			logs = append(logs, chunks[i]...)
+		}
+		sortLogsByStart(logs)
+
+		for i, entry := range logs {
+			if got, want := logStartTime(entry), at(12*i); !got.Equal(want) {
+				t.Errorf("chunk order %v: log %d starts at %v, want %v", order, i, got, want)
+			}
+		}
+	}
+}
+
+func TestSortLogsByStartKeepsUndatedLogsFirst(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	logs := []interface{}{
+		services.FlowLog{Start: start},
+		map[string]interface{}{"start": "not a time", "nodeId": "a"},
+		map[string]interface{}{"nodeId": "b"},
+	}
+	sortLogsByStart(logs)
+
+	if m, ok := logs[0].(map[string]interface{}); !ok || m["nodeId"] != "a" {
+		t.Errorf("logs[0] = %v, want undated log a", logs[0])
+	}
+	if m, ok := logs[1].(map[string]interface{}); !ok || m["nodeId"] != "b" {
+		t.Errorf("logs[1] = %v, want undated log b", logs[1])
+	}
+	if _, ok := logs[2].(services.FlowLog); !ok {
+		t.Errorf("logs[2] = %v, want the dated log", logs[2])
+	}
+}
+
+func TestUpstreamErrorsCarryRequestID(t *testing.T) {
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+	req = req.WithContext(utils.WithRequestID(req.Context(), "req-123"))
+	w := serve(h.GetDevices, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", w.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["requestId"] != "req-123" {
+		t.Errorf("requestId = %v, want req-123", body["requestId"])
+	}
+}
+
+func TestClientDisconnectCancelsUpstreamCall(t *testing.T) {
+	cancelled := make(chan struct{})
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/devices", nil).WithContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	serve(h.GetDevices, req)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("handler returned after %v, want soon after the client left", elapsed)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Error("upstream request was not cancelled with the client request")
+	}
+}
+
+func TestSampleLogs(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		ceiling  int
+		wantLen  int
+		wantRate int
+	}{
+		{"no logs", 0, 5, 0, 1},
+		{"under the ceiling", 3, 5, 3, 1},
+		{"at the ceiling", 5, 5, 5, 1},
+		{"one over the ceiling", 6, 5, 3, 2},
+		{"twice the ceiling", 10, 5, 5, 2},
+		{"one more than twice the ceiling", 11, 5, 4, 3},
+		{"ceiling of one", 7, 1, 1, 7},
+		{"ceiling of one with one log", 1, 1, 1, 1},
+		{"zero ceiling", 7, 0, 7, 1},
+		{"negative ceiling", 7, -1, 7, 1},
+		{"zero ceiling and no logs", 0, 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := make([]interface{}, tt.n)
+			for i := range logs {
+				logs[i] = i
+			}
+
+			sampled, rate := sampleLogs(logs, tt.ceiling)
+			if sampled == nil {
+				t.Fatal("sampled is nil, want an empty list")
+			}
+			if len(sampled) != tt.wantLen || rate != tt.wantRate {
+				t.Fatalf("sampleLogs(%d, %d) = %d logs at rate %d, want %d at rate %d", tt.n, tt.ceiling, len(sampled), rate, tt.wantLen, tt.wantRate)
+			}
+			if tt.ceiling > 0 && len(sampled) > tt.ceiling {
+				t.Errorf("kept %d logs, over the ceiling of %d", len(sampled), tt.ceiling)
+			}
+			for i, entry := range sampled {
+				if entry != i*rate {
+					t.Errorf("sampled[%d] = %v, want log %d", i, entry, i*rate)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeChunkLogs(t *testing.T) {
+	chunk := func(n int) interface{} {
+		logs := make([]interface{}, n)
+		return map[string]interface{}{"logs": logs}
+	}
+	// Three chunks of 4 logs, in both shapes the fetch paths return
+	chunks := []interface{}{chunk(4), make([]interface{}, 4), chunk(4)}
+
+	tests := []struct {
+		maxLogs       int
+		wantLen       int
+		wantTruncated bool
+	}{
+		{13, 12, false},
+		{12, 12, false},
+		{11, 11, true},
+		{8, 8, true},
+		{5, 5, true},
+		{1, 1, true},
+	}
+
+	for _, tt := range tests {
+		logs, truncated, err := mergeChunkLogs(chunks, tt.maxLogs, services.FlowFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != tt.wantLen || truncated != tt.wantTruncated {
+			t.Errorf("maxLogs %d: %d logs, truncated %v; want %d, %v", tt.maxLogs, len(logs), truncated, tt.wantLen, tt.wantTruncated)
+		}
+	}
+}
+
+func TestMergeChunkLogsFiltersBeforeLimit(t *testing.T) {
+	flowLog := func(port int) interface{} {
+		return map[string]interface{}{
+			"nodeId": "n1",
+			"start":  "2025-06-01T00:00:00Z",
+			"virtualTraffic": []interface{}{
+				map[string]interface{}{"proto": 6, "src": "100.64.0.1:50000", "dst": fmt.Sprintf("100.64.0.2:%d", port)},
+			},
+		}
+	}
+	// Matching logs sit behind non-matching ones, so truncating before
+	// filtering would drop them
+	chunks := []interface{}{
+		map[string]interface{}{"logs": []interface{}{flowLog(80), flowLog(80), flowLog(443)}},
+		[]interface{}{flowLog(80), flowLog(443)},
+	}
+	filter := services.FlowFilter{Ports: map[string]bool{"443": true}}
+
+	logs, truncated, err := mergeChunkLogs(chunks, 2, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || truncated {
+		t.Fatalf("%d logs, truncated %v; want both matching logs untruncated", len(logs), truncated)
+	}
+	for i, l := range logs {
+		if port := l.(services.FlowLog).VirtualTraffic[0].Dst; port != "100.64.0.2:443" {
+			t.Errorf("log %d dst = %s, want port 443", i, port)
+		}
+	}
+}
+
+// chunkedLogsUpstream serves perChunk logs for each network log request
+func chunkedLogsUpstream(perChunk int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/tailnet/example.com/logging/network" {
+			http.NotFound(w, r)
+			return
+		}
+		logs := make([]map[string]string, perChunk)
+		for i := range logs {
+			logs[i] = map[string]string{"start": r.URL.Query().Get("start")}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"logs": logs})
+	})
+}
+
+func TestGetNetworkLogsChunkedLimits(t *testing.T) {
+	// Eight day-long chunks of two logs each, 16 in all
+	const rangeQuery = "start=2025-06-01T00:00:00Z&end=2025-06-09T00:00:00Z"
+
+	tests := []struct {
+		name          string
+		maxLogs       int
+		sampleCeiling int
+		query         string
+		wantStatus    int
+		wantLogs      int
+		wantTruncated bool
+		wantRate      int
+	}{
+		{"at the log limit", 16, 16, "", http.StatusOK, 16, false, 1},
+		{"one over the log limit", 15, 15, "", http.StatusOK, 15, true, 1},
+		{"one over the log limit unsampled", 15, 15, "&sample=false", http.StatusRequestEntityTooLarge, 0, false, 0},
+		{"at the log limit unsampled", 16, 16, "&sample=false", http.StatusOK, 16, false, 1},
+		{"over the sample ceiling", 100, 8, "", http.StatusOK, 8, false, 2},
+		{"over the sample ceiling unsampled", 100, 8, "&sample=false", http.StatusRequestEntityTooLarge, 0, false, 0},
+		{"at the sample ceiling unsampled", 100, 16, "&sample=false", http.StatusOK, 16, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, chunkedLogsUpstream(2))
+			h.cfg.MaxLogs = tt.maxLogs
+			h.cfg.SampleCeiling = tt.sampleCeiling
+
+			w := serve(h.GetNetworkLogs, httptest.NewRequest(http.MethodGet, "/api/network-logs?"+rangeQuery+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Logs     []interface{} `json:"logs"`
+				Metadata struct {
+					TotalLogs  int  `json:"totalLogs"`
+					Truncated  bool `json:"truncated"`
+					Sampled    bool `json:"sampled"`
+					SampleRate int  `json:"sampleRate"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Logs) != tt.wantLogs {
+				t.Errorf("%d logs, want %d", len(body.Logs), tt.wantLogs)
+			}
+			if body.Metadata.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", body.Metadata.Truncated, tt.wantTruncated)
+			}
+			if body.Metadata.SampleRate != tt.wantRate || body.Metadata.Sampled != (tt.wantRate > 1) {
+				t.Errorf("sampled %v at rate %d, want rate %d", body.Metadata.Sampled, body.Metadata.SampleRate, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestGetNetworkLogsChunkedDefaultLimits(t *testing.T) {
+	// Eight day-long chunks of 6251 logs each, 50008 in all: just over the
+	// default sample ceiling and under the default log limit
+	const rangeQuery = "start=2025-06-01T00:00:00Z&end=2025-06-09T00:00:00Z"
+	defaults := config.Load()
+
+	h := newTestHandlers(t, chunkedLogsUpstream(6251))
+	h.cfg.MaxLogs = defaults.MaxLogs
+	h.cfg.SampleCeiling = defaults.SampleCeiling
+
+	w := serve(h.GetNetworkLogs, httptest.NewRequest(http.MethodGet, "/api/network-logs?"+rangeQuery, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Logs     []interface{} `json:"logs"`
+		Metadata struct {
+			TotalLogs  int  `json:"totalLogs"`
+			Truncated  bool `json:"truncated"`
+			SampleRate int  `json:"sampleRate"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Metadata.TotalLogs != 50008 || body.Metadata.Truncated || body.Metadata.SampleRate != 2 || len(body.Logs) != 25004 {
+		t.Errorf("%d of %d logs, truncated %v, rate %d; want 25004 of 50008 untruncated at rate 2",
+			len(body.Logs), body.Metadata.TotalLogs, body.Metadata.Truncated, body.Metadata.SampleRate)
+	}
+
+	w = serve(h.GetNetworkLogs, httptest.NewRequest(http.MethodGet, "/api/network-logs?"+rangeQuery+"&sample=false", nil))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("sample=false: status %d, want 413", w.Code)
+	}
+}
+
+func TestGetNetworkLogsChunkedEmptyRange(t *testing.T) {
+	h := newTestHandlers(t, chunkedLogsUpstream(0))
+
+	w := serve(h.GetNetworkLogs, httptest.NewRequest(http.MethodGet, "/api/network-logs?start=2025-06-01T00:00:00Z&end=2025-06-09T00:00:00Z", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var body struct {
+		Logs     []interface{} `json:"logs"`
+		Metadata struct {
+			Sampled    bool `json:"sampled"`
+			SampleRate int  `json:"sampleRate"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Logs == nil || len(body.Logs) != 0 {
+		t.Errorf("logs = %v, want []", body.Logs)
+	}
+	if body.Metadata.Sampled || body.Metadata.SampleRate != 1 {
+		t.Errorf("sampled %v at rate %d, want unsampled at rate 1", body.Metadata.Sampled, body.Metadata.SampleRate)
+	}
+}
+
+func TestGetIPFlowsAddressForms(t *testing.T) {
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/devices":
+			w.Write([]byte(`{"devices":[]}`))
+		case "/api/v2/tailnet/example.com/logging/network":
+			w.Write([]byte(`{"logs":[{"nodeId":"n1","start":"2025-06-01T00:00:00Z","end":"2025-06-01T00:00:05Z","virtualTraffic":[
+				{"proto":6,"src":"100.64.0.1:443","dst":"100.64.0.2:5432","txBytes":10},
+				{"proto":6,"src":"[fe80::1]:443","dst":"100.64.0.2:80","txBytes":10}
+			]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	router := gin.New()
+	router.GET("/api/flows/ip/:ip", h.GetIPFlows)
+
+	tests := []struct {
+		name       string
+		ip         string
+		wantStatus int
+		wantIP     string
+		wantFlows  int
+	}{
+		{"IPv4", "100.64.0.1", http.StatusOK, "100.64.0.1", 1},
+		{"IPv4-mapped IPv6", "::ffff:100.64.0.1", http.StatusOK, "100.64.0.1", 1},
+		{"bracketed IPv6", "[fe80::1]", http.StatusOK, "fe80::1", 1},
+		{"zone-suffixed IPv6", "fe80::1%25eth0", http.StatusOK, "fe80::1", 1},
+		{"garbage", "not-an-ip", http.StatusBadRequest, "", 0},
+		{"empty zone", "fe80::1%25", http.StatusBadRequest, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/flows/ip/"+tt.ip+"?start=2025-06-01T00:00:00Z&end=2025-06-01T01:00:00Z", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				IP    string        `json:"ip"`
+				Flows []interface{} `json:"flows"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.IP != tt.wantIP || len(body.Flows) != tt.wantFlows {
+				t.Errorf("ip %q with %d flows, want %q with %d", body.IP, len(body.Flows), tt.wantIP, tt.wantFlows)
+			}
+		})
+	}
+}
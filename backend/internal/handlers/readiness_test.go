@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadinessIgnoresCallerCancellation(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"devices":[]}`))
+	}))
+
+	// The prober hangs up before the upstream check runs
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil).WithContext(ctx)
+
+	if w := serve(h.ReadinessCheck, req); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	// The success is cached for the next prober
+	if w := serve(h.ReadinessCheck, httptest.NewRequest(http.MethodGet, "/ready", nil)); w.Code != http.StatusOK {
+		t.Errorf("second probe: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times, want 1", n)
+	}
+}
+
+func TestReadinessCachesUpstreamFailure(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestHandlers(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "invalid key", http.StatusUnauthorized)
+	}))
+
+	for i := 0; i < 3; i++ {
+		if w := serve(h.ReadinessCheck, httptest.NewRequest(http.MethodGet, "/ready", nil)); w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("probe %d: status %d, want %d", i, w.Code, http.StatusServiceUnavailable)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times, want 1 within the TTL", n)
+	}
+}
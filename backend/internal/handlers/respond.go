@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/utils"
+)
+
+// upstreamStatus is the status for a failed Tailscale API call: 503 while the
+// circuit breaker is failing requests fast, 500 otherwise
+func upstreamStatus(err error) int {
+	if errors.Is(err, utils.ErrCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// errorJSON writes an error response carrying the request ID, so a failure a
+// user reports can be matched to the server logs
+func errorJSON(c *gin.Context, status int, body gin.H) {
+	if id := utils.RequestID(c.Request.Context()); id != "" {
+		body["requestId"] = id
+	}
+	c.JSON(status, body)
+}
+
+// marshalResponse encodes v for a JSON response. If the encoded body exceeds
+// TSFLOW_MAX_RESPONSE_BYTES it writes a 413 instead, before anything is sent,
+// and returns ok=false; likewise a 500 if encoding fails.
+func (h *Handlers) marshalResponse(c *gin.Context, v interface{}) (body []byte, ok bool) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("ERROR failed to encode response: %v", err)
+		errorJSON(c, http.StatusInternalServerError, gin.H{
+			"error":   "Failed to encode response",
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+
+	if limit := h.cfg.MaxResponseBytes; limit > 0 && len(body) > limit {
+		log.Printf("WARNING %s response of %d bytes exceeds the %d byte limit", c.Request.URL.Path, len(body), limit)
+		errorJSON(c, http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "Response too large",
+			"message": fmt.Sprintf("response would be %d bytes, over the %d byte limit", len(body), limit),
+			"hint":    "Try selecting a smaller time range",
+		})
+		return nil, false
+	}
+
+	return body, true
+}
+
+// sizedJSON writes v as a 200 JSON response, subject to the response size limit
+func (h *Handlers) sizedJSON(c *gin.Context, v interface{}) {
+	body, ok := h.marshalResponse(c, v)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// servicesUpstream stubs the VIP services and static records endpoints and
+// counts how often each is called
+type servicesUpstream struct {
+	servicesCalls atomic.Int32
+	recordsCalls  atomic.Int32
+	failRecords   bool
+}
+
+func (u *servicesUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v2/tailnet/example.com/services":
+		u.servicesCalls.Add(1)
+		w.Write([]byte(`{"vipServices":[{"name":"svc:web","addrs":["100.100.1.1"]}]}`))
+	case "/api/v2/tailnet/example.com/static-records":
+		u.recordsCalls.Add(1)
+		if u.failRecords {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"records":{"db.example.com":{"addrs":["100.64.0.9"],"comment":"primary"}}}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newServicesRouter(t *testing.T, upstream *servicesUpstream) *gin.Engine {
+	t.Helper()
+	h := newTestHandlers(t, upstream)
+	router := gin.New()
+	router.GET("/api/services", h.GetServicesAndRecords)
+	return router
+}
+
+func TestGetServicesAndRecords(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		failRecords  bool
+		wantStatus   int
+		wantServices bool
+		wantRecords  bool
+		wantRecCount int
+	}{
+		{"default includes both", "", false, http.StatusOK, true, true, 1},
+		{"services only", "?include=services", false, http.StatusOK, true, false, 0},
+		{"records only", "?include=records", false, http.StatusOK, false, true, 1},
+		{"both with spaces", "?include=records,%20services", false, http.StatusOK, true, true, 1},
+		{"unknown include", "?include=services,devices", false, http.StatusBadRequest, false, false, 0},
+		{"records upstream fails", "?include=records", true, http.StatusOK, false, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &servicesUpstream{failRecords: tt.failRecords}
+			router := newServicesRouter(t, upstream)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/services"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := body["services"]; ok != tt.wantServices {
+				t.Errorf("services present = %v, want %v", ok, tt.wantServices)
+			}
+			if _, ok := body["records"]; ok != tt.wantRecords {
+				t.Errorf("records present = %v, want %v", ok, tt.wantRecords)
+			}
+			if got := upstream.servicesCalls.Load() > 0; got != tt.wantServices {
+				t.Errorf("services fetched = %v, want %v", got, tt.wantServices)
+			}
+			if got := upstream.recordsCalls.Load() > 0; got != tt.wantRecords {
+				t.Errorf("records fetched = %v, want %v", got, tt.wantRecords)
+			}
+
+			if tt.wantRecords {
+				var records map[string]json.RawMessage
+				if err := json.Unmarshal(body["records"], &records); err != nil {
+					t.Fatal(err)
+				}
+				if len(records) != tt.wantRecCount {
+					t.Errorf("got %d records, want %d", len(records), tt.wantRecCount)
+				}
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				if _, ok := body["error"]; !ok {
+					t.Errorf("body %s has no error", w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rajsinghtech/tsflow/backend/internal/services"
+)
+
+const (
+	defaultStreamInterval = 5 * time.Second
+	// Flow logs reach the API with some delay, so each poll re-reads a short
+	// trailing window and relies on de-duplication to send only new flows
+	streamLookback = 2 * time.Minute
+	// Upper bound on remembered flow IDs per connection
+	maxStreamedFlowIDs = 50000
+	streamWriteTimeout = 10 * time.Second
+	// streamFetchTimeout bounds one shared poll of the upstream API
+	streamFetchTimeout = 30 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// flowIDSet remembers recently sent flow IDs, forgetting the oldest beyond max
+type flowIDSet struct {
+	ids   map[string]struct{}
+	order []string
+	max   int
+}
+
+func newFlowIDSet(max int) *flowIDSet {
+	return &flowIDSet{ids: make(map[string]struct{}), max: max}
+}
+
+// Add records id and reports whether it was not already present
+func (s *flowIDSet) Add(id string) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if len(s.order) >= s.max {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	return true
+}
+
+// flowPoll holds the latest trailing window of flows fetched for live streams.
+// Every connection reads from it, so the upstream API (devices, VIP services
+// and logs) is polled about once per interval however many clients are
+// connected.
+type flowPoll struct {
+	mu        sync.Mutex
+	flows     []services.RawFlowEntry
+	fetchedAt time.Time
+}
+
+// recentFlows returns the flows of the last streamLookback, fetching them only
+// when the shared poll is at least maxAge old. The returned slice is shared and
+// must not be modified.
+func (h *Handlers) recentFlows(maxAge time.Duration) ([]services.RawFlowEntry, error) {
+	poll := &h.streamPoll
+	poll.mu.Lock()
+	defer poll.mu.Unlock()
+
+	if time.Since(poll.fetchedAt) < maxAge {
+		return poll.flows, nil
+	}
+
+	// Detached from any one connection, so a client leaving mid-fetch does not
+	// fail the poll for the others
+	ctx, cancel := context.WithTimeout(context.Background(), streamFetchTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	flows, err := h.tailscaleService.GetRawFlows(ctx, now.Add(-streamLookback), now)
+	if err != nil {
+		return nil, err
+	}
+	poll.flows, poll.fetchedAt = flows, time.Now()
+	return flows, nil
+}
+
+// StreamRawFlows upgrades to a WebSocket and pushes newly seen flows as JSON
+// frames, polling the upstream API every ?interval= (default 5s). The flow
+// filters given at connect time apply to every frame.
+func (h *Handlers) StreamRawFlows(c *gin.Context) {
+	interval := defaultStreamInterval
+	if v := c.Query("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second || d > time.Minute {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error": "interval must be a duration between 1s and 1m",
+			})
+			return
+		}
+		interval = d
+	}
+
+	filter, err := parseFlowFilters(c)
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{"error": "invalid filter", "message": err.Error()})
+		return
+	}
+	// Tag and user filters match the devices as they were at connect time
+	if filter.NeedsDevices() {
+		devices, ok := h.filterDevices(c, "StreamRawFlows")
+		if !ok {
+			return
+		}
+		filter.SetDevices(devices)
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an HTTP error response
+		log.Printf("ERROR StreamRawFlows upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// The client never sends data; reading only detects the disconnect
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sent := newFlowIDSet(maxStreamedFlowIDs)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		flows, err := h.recentFlows(interval)
+		if err != nil {
+			log.Printf("WARNING StreamRawFlows fetch failed: %v", err)
+		}
+
+		for _, flow := range services.FilterRawFlows(flows, filter) {
+			if !sent.Add(flow.ID) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(flow); err != nil {
+				log.Printf("StreamRawFlows client gone: %v", err)
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/services"
+	"github.com/rajsinghtech/tsflow/backend/internal/utils"
+)
+
+const (
+	// summaryTTL is how long a computed dashboard summary is reused
+	summaryTTL = 30 * time.Second
+	// summaryTopN is how many protocols and talkers the summary lists
+	summaryTopN = 5
+	// defaultTopTalkers is how many talkers GetTopTalkers lists by default
+	defaultTopTalkers = 10
+	// maxTopTalkersRange is the longest window GetTopTalkers accepts
+	maxTopTalkersRange = 7 * 24 * time.Hour
+)
+
+// GetSummary returns device counts, flow totals, the top protocols and the top
+// talkers over the default flow window in a single response. The device list
+// is fetched once and reused to name the flows, and the result is cached
+// briefly.
+func (h *Handlers) GetSummary(c *gin.Context) {
+	if body, ok := h.cache.get("summary"); ok {
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	end := time.Now()
+	start := end.Add(-defaultFlowWindow)
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetSummary failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, err := h.tailscaleService.GetRawFlowsWithDevices(c.Request.Context(), start, end, devices.Devices)
+	if err != nil {
+		log.Printf("%sERROR GetSummary failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch network flows",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	onlineDevices := 0
+	for _, device := range devices.Devices {
+		if device.Online {
+			onlineDevices++
+		}
+	}
+
+	var totalBytes int64
+	for _, flow := range flows {
+		totalBytes += flow.TotalBytes
+	}
+
+	protocols := services.SummarizeByProtocol(flows)
+	if len(protocols) > summaryTopN {
+		protocols = protocols[:summaryTopN]
+	}
+
+	body := gin.H{
+		"totalDevices":  len(devices.Devices),
+		"onlineDevices": onlineDevices,
+		"totalFlows":    len(flows),
+		"totalBytes":    totalBytes,
+		"topProtocols":  protocols,
+		"topTalkers":    services.TopTalkers(devices.Devices, flows, summaryTopN),
+		"timeRange":     timeRangeJSON(start, end),
+	}
+	h.cache.set("summary", body, summaryTTL)
+
+	log.Printf("SUCCESS GetSummary: %d devices, %d flows", len(devices.Devices), len(flows))
+	c.JSON(http.StatusOK, body)
+}
+
+// GetTopTalkers returns the ?top= (default 10) devices, or addresses no device
+// owns, that sent and received the most bytes over the requested window of at
+// most 7 days, with tx and rx totals and flow counts
+func (h *Handlers) GetTopTalkers(c *gin.Context) {
+	top := defaultTopTalkers
+	if raw := c.Query("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			errorJSON(c, http.StatusBadRequest, gin.H{
+				"error":   "invalid top",
+				"message": "top must be a positive integer",
+			})
+			return
+		}
+		top = n
+	}
+
+	// The range is checked before anything is fetched
+	start, end, err := parseTimeRange(c, defaultFlowWindow)
+	if err == nil && end.Sub(start) > maxTopTalkersRange {
+		err = fmt.Errorf("time range must not exceed %d days", int(maxTopTalkersRange.Hours()/24))
+	}
+	if err != nil {
+		errorJSON(c, http.StatusBadRequest, gin.H{
+			"error":   "invalid time range",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	devices, err := h.tailscaleService.GetDevices(c.Request.Context())
+	if err != nil {
+		log.Printf("%sERROR GetTopTalkers failed: %v", utils.LogPrefix(c.Request.Context()), err)
+		errorJSON(c, upstreamStatus(err), gin.H{
+			"error":   "Failed to fetch devices",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	flows, start, end, ok := h.fetchRawFlowsWithDevices(c, "GetTopTalkers", devices.Devices)
+	if !ok {
+		return
+	}
+
+	talkers := services.ComputeTopTalkers(devices.Devices, flows, top)
+
+	log.Printf("SUCCESS GetTopTalkers: %d talkers from %d flows", len(talkers), len(flows))
+	c.JSON(http.StatusOK, gin.H{
+		"talkers":    talkers,
+		"totalFlows": len(flows),
+		"timeRange":  timeRangeJSON(start, end),
+	})
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	upstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tsflow",
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Duration of requests to the Tailscale API by endpoint and status.",
+		// Network log queries can take minutes, so extend well past the default buckets
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{"endpoint", "status"})
+
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tsflow",
+		Name:      "upstream_retries_total",
+		Help:      "Number of retried requests to the Tailscale API by endpoint.",
+	}, []string{"endpoint"})
+
+	upstreamCircuitState = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tsflow",
+		Name:      "upstream_circuit_state",
+		Help:      "State of the Tailscale API circuit breaker: 0 closed, 1 half-open, 2 open.",
+	})
+
+	upstreamCircuitRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tsflow",
+		Name:      "upstream_circuit_rejections_total",
+		Help:      "Number of Tailscale API requests failed fast by the open circuit breaker.",
+	})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tsflow",
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests served by route, method and status.",
+	}, []string{"route", "method", "status"})
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// InstrumentTransport wraps rt so every request to the Tailscale API is timed
+func InstrumentTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := rt.RoundTrip(req)
+
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(resp.StatusCode)
+		}
+		upstreamRequestDuration.WithLabelValues(endpointLabel(req.URL.Path), status).Observe(time.Since(start).Seconds())
+
+		return resp, err
+	})
+}
+
+// RecordRetry counts a retry of the given API endpoint
+func RecordRetry(endpoint string) {
+	upstreamRetries.WithLabelValues(endpointLabel(endpoint)).Inc()
+}
+
+// SetCircuitState records the circuit breaker state (0 closed, 1 half-open, 2 open)
+func SetCircuitState(state int) {
+	upstreamCircuitState.Set(float64(state))
+}
+
+// RecordCircuitRejection counts a request failed fast by the open circuit breaker
+func RecordCircuitRejection() {
+	upstreamCircuitRejections.Inc()
+}
+
+// Middleware counts served requests by matched route
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// Handler serves the Prometheus scrape endpoint
+func Handler() gin.HandlerFunc {
+	// The router's gzip middleware already compresses responses
+	return gin.WrapH(promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		DisableCompression: true,
+	}))
+}
+
+// endpointLabel reduces an API path to a low-cardinality label by dropping
+// the query string and the common /api/v2 prefix
+func endpointLabel(endpoint string) string {
+	endpoint, _, _ = strings.Cut(endpoint, "?")
+	return strings.TrimPrefix(endpoint, "/api/v2")
+}
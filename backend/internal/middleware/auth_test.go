@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		given      string
+		want       int
+	}{
+		{"no token configured", "", "", http.StatusNotFound},
+		{"no token configured ignores header", "", "anything", http.StatusNotFound},
+		{"missing token", "s3cret", "", http.StatusForbidden},
+		{"wrong token", "s3cret", "guess", http.StatusForbidden},
+		{"correct token", "s3cret", "s3cret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/api/config", RequireAdmin(tt.configured), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"tailnet": "example.com"})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+			if tt.given != "" {
+				req.Header.Set(AdminTokenHeader, tt.given)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
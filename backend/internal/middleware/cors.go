@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// CORS applies the cross-origin policy from TSFLOW_CORS_ORIGINS. An explicit
+// origin list is allowed with credentials; "*" allows any origin without
+// them, since browsers reject credentialed responses to a wildcard. With no
+// list, development allows any origin but production allows none, because
+// the bundled frontend is served from the same origin and needs no CORS.
+func CORS(origins []string, environment string) gin.HandlerFunc {
+	corsConfig := cors.DefaultConfig()
+	switch {
+	case len(origins) > 0 && origins[0] != "*":
+		corsConfig.AllowOrigins = origins
+		corsConfig.AllowCredentials = true
+	case len(origins) == 0 && environment == "production":
+		log.Printf("TSFLOW_CORS_ORIGINS not set, cross-origin requests are refused in production")
+		corsConfig.AllowOriginFunc = func(string) bool { return false }
+	default:
+		if len(origins) == 0 {
+			log.Printf("WARNING TSFLOW_CORS_ORIGINS not set, allowing cross-origin requests from any origin in %s", environment)
+		}
+		corsConfig.AllowAllOrigins = true
+		corsConfig.AllowCredentials = false
+	}
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "If-None-Match", RequestIDHeader, AdminTokenHeader}
+	corsConfig.ExposeHeaders = []string{"ETag", "X-Uncompressed-Length", "Content-Encoding", RequestIDHeader}
+	return cors.New(corsConfig)
+}
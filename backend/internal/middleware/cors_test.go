@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORS(t *testing.T) {
+	const origin = "https://evil.example"
+	tests := []struct {
+		name            string
+		origins         []string
+		environment     string
+		requestOrigin   string
+		wantStatus      int
+		wantAllowOrigin string
+		wantCredentials bool
+	}{
+		{"production default refuses other origins", nil, "production", origin, http.StatusForbidden, "", false},
+		{"production default serves its own origin", nil, "production", "http://tsflow.test", http.StatusOK, "", false},
+		{"production default serves non-browser clients", nil, "production", "", http.StatusOK, "", false},
+		{"development default allows any origin", nil, "development", origin, http.StatusOK, "*", false},
+		{"explicit wildcard in production", []string{"*"}, "production", origin, http.StatusOK, "*", false},
+		{"allowlist permits listed origin", []string{"https://tsflow.example.com"}, "production", "https://tsflow.example.com", http.StatusOK, "https://tsflow.example.com", true},
+		{"allowlist refuses other origins", []string{"https://tsflow.example.com"}, "development", origin, http.StatusForbidden, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(CORS(tt.origins, tt.environment))
+			router.GET("/api/devices", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "http://tsflow.test/api/devices", nil)
+			if tt.requestOrigin != "" {
+				req.Header.Set("Origin", tt.requestOrigin)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.wantCredentials)
+			}
+		})
+	}
+}
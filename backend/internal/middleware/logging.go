@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Log formats accepted by TSFLOW_LOG_FORMAT
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// loggerSkipPaths are not logged, to keep probes and scrapes out of the request log
+var loggerSkipPaths = []string{"/health", "/health/ready", "/metrics"}
+
+// requestLogLine is one request in the JSON log format
+type requestLogLine struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	ClientIP  string  `json:"client_ip"`
+	Bytes     int     `json:"bytes"`
+	RequestID string  `json:"request_id,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// LogFormatter returns the request log formatter for format: one JSON object
+// per request for LogFormatJSON, otherwise a single plain text line
+func LogFormatter(format string) gin.LogFormatter {
+	if format == LogFormatJSON {
+		return func(param gin.LogFormatterParams) string {
+			line, err := json.Marshal(requestLogLine{
+				Time:      param.TimeStamp.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+				Method:    param.Method,
+				Path:      param.Path,
+				Status:    param.StatusCode,
+				LatencyMS: float64(param.Latency.Microseconds()) / 1000,
+				ClientIP:  param.ClientIP,
+				Bytes:     param.BodySize,
+				RequestID: requestIDParam(param),
+				Error:     param.ErrorMessage,
+			})
+			if err != nil {
+				return fmt.Sprintf("{\"error\":%q}\n", err.Error())
+			}
+			return string(line) + "\n"
+		}
+	}
+
+	return func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[%s] %s %s %d %s %s %s\n",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.Method,
+			param.Path,
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			requestIDParam(param),
+		)
+	}
+}
+
+// requestIDParam returns the ID set by RequestID, or "" if it did not run
+func requestIDParam(param gin.LogFormatterParams) string {
+	id, _ := param.Keys[RequestIDKey].(string)
+	return id
+}
+
+// Logger logs each request to stdout in the given format, skipping health
+// checks and metrics scrapes
+func Logger(format string) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: LogFormatter(format),
+		Output:    os.Stdout,
+		SkipPaths: loggerSkipPaths,
+	})
+}
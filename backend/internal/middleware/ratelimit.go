@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Client limiters idle for longer than this are dropped
+	limiterIdleTimeout = 10 * time.Minute
+	// maxTrackedClients bounds the limiter map; past it the least recently
+	// seen client is dropped
+	maxTrackedClients = 10000
+)
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter keeps a token bucket per client IP so one client can't exhaust
+// the upstream Tailscale API quota for everyone
+type RateLimiter struct {
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	rate      rate.Limit
+	burst     int
+	lastSwept time.Time
+}
+
+// NewRateLimiter allows each client requestsPerSecond on average with bursts up to burst
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		clients:   make(map[string]*clientLimiter),
+		rate:      rate.Limit(requestsPerSecond),
+		burst:     burst,
+		lastSwept: time.Now(),
+	}
+}
+
+func (rl *RateLimiter) limiterFor(clientIP string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastSwept) > limiterIdleTimeout {
+		for ip, client := range rl.clients {
+			if now.Sub(client.lastSeen) > limiterIdleTimeout {
+				delete(rl.clients, ip)
+			}
+		}
+		rl.lastSwept = now
+	}
+
+	client, ok := rl.clients[clientIP]
+	if !ok {
+		if len(rl.clients) >= maxTrackedClients {
+			rl.evictOldest()
+		}
+		client = &clientLimiter{limiter: rate.NewLimiter(rl.rate, rl.burst)}
+		rl.clients[clientIP] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
+
+// evictOldest drops the least recently seen client. Callers hold rl.mu.
+func (rl *RateLimiter) evictOldest() {
+	var oldestIP string
+	var oldest time.Time
+	for ip, client := range rl.clients {
+		if oldestIP == "" || client.lastSeen.Before(oldest) {
+			oldestIP, oldest = ip, client.lastSeen
+		}
+	}
+	delete(rl.clients, oldestIP)
+}
+
+// Middleware rejects requests over the client's limit with 429 and a Retry-After header.
+// Clients are keyed by c.ClientIP(), which only honours X-Forwarded-For from the
+// router's trusted proxies.
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := rl.limiterFor(c.ClientIP())
+		if limiter.Allow() {
+			c.Next()
+			return
+		}
+
+		// Ask how long until a token is free without consuming it
+		reservation := limiter.Reserve()
+		delay := reservation.Delay()
+		reservation.Cancel()
+
+		retryAfter := int(math.Ceil(delay.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		abortWithError(c, http.StatusTooManyRequests, gin.H{
+			"error":             "rate limit exceeded",
+			"requestsPerSecond": float64(rl.rate),
+			"burst":             rl.burst,
+			"retryAfterSeconds": retryAfter,
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRateLimitedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	router.Use(NewRateLimiter(1, 1).Middleware())
+	router.GET("/api/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	router := newRateLimitedRouter(t, nil)
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+		req.RemoteAddr = "203.0.113.7:40000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("request %d: status %d, want %d", i, w.Code, want)
+		}
+	}
+}
+
+func TestRateLimitHonoursTrustedProxy(t *testing.T) {
+	router := newRateLimitedRouter(t, []string{"10.0.0.0/8"})
+
+	// Two clients behind the same trusted proxy get separate buckets
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+		req.RemoteAddr = "10.1.2.3:40000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("client %d: status %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestRateLimiterBoundsTrackedClients(t *testing.T) {
+	rl := NewRateLimiter(1, 1)
+	for i := 0; i < maxTrackedClients+50; i++ {
+		rl.limiterFor(fmt.Sprintf("client-%d", i))
+	}
+	if n := len(rl.clients); n > maxTrackedClients {
+		t.Errorf("tracking %d clients, want at most %d", n, maxTrackedClients)
+	}
+	if _, ok := rl.clients[fmt.Sprintf("client-%d", maxTrackedClients+49)]; !ok {
+		t.Error("most recent client was evicted")
+	}
+}
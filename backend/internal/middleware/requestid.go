@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rajsinghtech/tsflow/backend/internal/utils"
+)
+
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the gin context key holding the request ID
+const RequestIDKey = "requestID"
+
+// maxRequestIDLength bounds an incoming request ID so clients can't bloat logs
+const maxRequestIDLength = 128
+
+// RequestID tags each request with an ID, reusing a well-formed incoming
+// X-Request-ID or generating one. The ID is echoed in the response header,
+// stored in the gin context for the request log, and carried by the request
+// context for logging further down.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// abortWithError aborts with a JSON error body carrying the request ID, when
+// RequestID has assigned one
+func abortWithError(c *gin.Context, status int, body gin.H) {
+	if id := c.GetString(RequestIDKey); id != "" {
+		body["requestId"] = id
+	}
+	c.AbortWithStatusJSON(status, body)
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII without spaces, so
+// they can be logged and echoed safely
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
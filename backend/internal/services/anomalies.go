@@ -0,0 +1,86 @@
+package services
+
+import (
+	"math"
+	"sort"
+)
+
+// MinAnomalyBucketSize is the fewest flows a protocol/port bucket needs before
+// its outliers are reported; smaller samples give meaningless statistics
+const MinAnomalyBucketSize = 10
+
+// FlowAnomaly is a flow whose byte count is unusually high for its bucket
+type FlowAnomaly struct {
+	RawFlowEntry
+	// Bucket is the protocol and destination port the flow was compared within, e.g. "TCP/443"
+	Bucket string `json:"bucket"`
+	// AnomalyScore is how many standard deviations TotalBytes is above the bucket mean
+	AnomalyScore float64 `json:"anomalyScore"`
+	BucketMean   float64 `json:"bucketMean"`
+	BucketStdDev float64 `json:"bucketStdDev"`
+}
+
+// DetectByteOutliers groups flows by protocol and destination port and flags
+// those whose TotalBytes exceed the bucket mean by more than k standard
+// deviations. Buckets with fewer than MinAnomalyBucketSize flows, or with no
+// variance, are skipped. This is a simple statistical heuristic: heavy-tailed
+// traffic will produce false positives, and it learns nothing across windows.
+// Results are sorted by score, highest first.
+func DetectByteOutliers(flows []RawFlowEntry, k float64) []FlowAnomaly {
+	buckets := make(map[string][]int)
+	for i, flow := range flows {
+		key := anomalyBucket(flow)
+		buckets[key] = append(buckets[key], i)
+	}
+
+	anomalies := []FlowAnomaly{}
+	for key, indexes := range buckets {
+		if len(indexes) < MinAnomalyBucketSize {
+			continue
+		}
+
+		var sum float64
+		for _, i := range indexes {
+			sum += float64(flows[i].TotalBytes)
+		}
+		mean := sum / float64(len(indexes))
+
+		var squares float64
+		for _, i := range indexes {
+			d := float64(flows[i].TotalBytes) - mean
+			squares += d * d
+		}
+		stdDev := math.Sqrt(squares / float64(len(indexes)))
+		if stdDev == 0 {
+			continue
+		}
+
+		for _, i := range indexes {
+			score := (float64(flows[i].TotalBytes) - mean) / stdDev
+			if score > k {
+				anomalies = append(anomalies, FlowAnomaly{
+					RawFlowEntry: flows[i],
+					Bucket:       key,
+					AnomalyScore: score,
+					BucketMean:   mean,
+					BucketStdDev: stdDev,
+				})
+			}
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].AnomalyScore != anomalies[j].AnomalyScore {
+			return anomalies[i].AnomalyScore > anomalies[j].AnomalyScore
+		}
+		return anomalies[i].ID < anomalies[j].ID
+	})
+	return anomalies
+}
+
+func anomalyBucket(flow RawFlowEntry) string {
+	if flow.DestinationPort == "" {
+		return flow.Protocol
+	}
+	return flow.Protocol + "/" + flow.DestinationPort
+}
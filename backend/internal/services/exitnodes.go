@@ -0,0 +1,109 @@
+package services
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// CountryBytes is the traffic an exit node sent toward one destination country
+type CountryBytes struct {
+	Country string `json:"country"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// ExitNodeTraffic totals an exit node's internet-bound traffic
+type ExitNodeTraffic struct {
+	DeviceID      string `json:"deviceId"`
+	Name          string `json:"name"`
+	Online        bool   `json:"online"`
+	EgressBytes   int64  `json:"egressBytes"`
+	EgressPackets int64  `json:"egressPackets"`
+	FlowCount     int    `json:"flowCount"`
+	// TopCountries is only populated when GeoIP enrichment is enabled
+	TopCountries []CountryBytes `json:"topCountries,omitempty"`
+}
+
+// IsExitNode reports whether the device has an approved default route
+func (d Device) IsExitNode() bool {
+	for _, route := range d.EnabledRoutes {
+		if route == "0.0.0.0/0" || route == "::/0" {
+			return true
+		}
+	}
+	return false
+}
+
+// SummarizeExitNodeTraffic totals, per exit node, the flows that the node logged
+// or that involve one of its addresses and whose destination is a public
+// address. Flows entirely between tailnet devices, and inbound flows from a
+// public source, are not egress and are excluded. Results are sorted by
+// egress bytes descending, with at most topCountries countries each.
+func SummarizeExitNodeTraffic(devices []Device, flows []RawFlowEntry, topCountries int) []ExitNodeTraffic {
+	result := []ExitNodeTraffic{}
+	for _, device := range devices {
+		if !device.IsExitNode() {
+			continue
+		}
+
+		summary := ExitNodeTraffic{
+			DeviceID: device.ID,
+			Name:     device.Name,
+			Online:   device.Online,
+		}
+		addresses := deviceAddressSet(device)
+		countries := make(map[string]int64)
+
+		for _, flow := range flows {
+			loggedByNode := device.NodeID != "" && flow.NodeID == device.NodeID
+			if !loggedByNode && !addresses[flow.SourceIP] && !addresses[flow.DestinationIP] {
+				continue
+			}
+			if !isPublicAddress(flow.DestinationIP) {
+				continue
+			}
+
+			summary.EgressBytes += flow.TotalBytes
+			summary.EgressPackets += flow.TotalPackets
+			summary.FlowCount++
+			if flow.DestinationCountry != "" {
+				countries[flow.DestinationCountry] += flow.TotalBytes
+			}
+		}
+
+		summary.TopCountries = topCountryBytes(countries, topCountries)
+		result = append(result, summary)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].EgressBytes > result[j].EgressBytes
+	})
+	return result
+}
+
+// isPublicAddress reports whether ip parses as a public (non-tailnet, non-private) address
+func isPublicAddress(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && isPublicIP(addr)
+}
+
+func topCountryBytes(countries map[string]int64, limit int) []CountryBytes {
+	if len(countries) == 0 {
+		return nil
+	}
+
+	result := make([]CountryBytes, 0, len(countries))
+	for country, bytes := range countries {
+		result = append(result, CountryBytes{Country: country, Bytes: bytes})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].Country < result[j].Country
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
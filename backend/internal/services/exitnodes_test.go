@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestSummarizeExitNodeTrafficEgressOnly(t *testing.T) {
+	devices := []Device{
+		{ID: "exit", Name: "exit", NodeID: "n-exit", Addresses: []string{"100.64.0.1"}, EnabledRoutes: []string{"0.0.0.0/0", "::/0"}},
+		{ID: "laptop", Name: "laptop", Addresses: []string{"100.64.0.2"}},
+	}
+	flows := []RawFlowEntry{
+		// Egress to the internet, logged by the exit node
+		{NodeID: "n-exit", SourceIP: "100.64.0.2", DestinationIP: "1.1.1.1", TotalBytes: 100, TotalPackets: 2, DestinationCountry: "AU"},
+		// Egress from the exit node's own address
+		{SourceIP: "100.64.0.1", DestinationIP: "2606:4700::1111", TotalBytes: 50, TotalPackets: 1},
+		// Inbound from a public source is not egress
+		{NodeID: "n-exit", SourceIP: "203.0.113.7", DestinationIP: "100.64.0.1", TotalBytes: 1000, TotalPackets: 10},
+		// Tailnet-internal traffic is not egress
+		{NodeID: "n-exit", SourceIP: "100.64.0.2", DestinationIP: "100.64.0.1", TotalBytes: 1000, TotalPackets: 10},
+	}
+
+	got := SummarizeExitNodeTraffic(devices, flows, 5)
+	if len(got) != 1 {
+		t.Fatalf("got %d exit nodes, want 1: %+v", len(got), got)
+	}
+	exit := got[0]
+	if exit.DeviceID != "exit" || exit.EgressBytes != 150 || exit.EgressPackets != 3 || exit.FlowCount != 2 {
+		t.Errorf("exit node = %+v, want 150 bytes, 3 packets, 2 flows", exit)
+	}
+	if len(exit.TopCountries) != 1 || exit.TopCountries[0] != (CountryBytes{Country: "AU", Bytes: 100}) {
+		t.Errorf("top countries = %+v, want AU 100", exit.TopCountries)
+	}
+}
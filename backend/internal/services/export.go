@@ -0,0 +1,38 @@
+package services
+
+import (
+	"fmt"
+)
+
+// FlowSummaryFormat describes the line layout produced by FormatFlowSummary
+const FlowSummaryFormat = "timestamp src[.port] > dst[.port]: protocol bytes"
+
+// flowSummaryTimeLayout is RFC 3339 in UTC with microseconds, like tcpdump -tttt
+const flowSummaryTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// FormatFlowSummary renders a flow as a single tcpdump-style line, e.g.
+//
+//	2025-01-02T15:04:05.000000Z 100.64.0.1.51234 > 100.64.0.2.443: TCP 1532 bytes
+//
+// Ports are appended with a dot as tcpdump does and omitted when the flow has
+// none. A humanized flow shows its byte count as e.g. "1.5 KiB" instead.
+func FormatFlowSummary(flow RawFlowEntry) string {
+	bytes := fmt.Sprintf("%d bytes", flow.TotalBytes)
+	if flow.TotalBytesHuman != "" {
+		bytes = flow.TotalBytesHuman
+	}
+	return fmt.Sprintf("%s %s > %s: %s %s",
+		flow.StartTime.UTC().Format(flowSummaryTimeLayout),
+		summaryEndpoint(flow.SourceIP, flow.SourcePort),
+		summaryEndpoint(flow.DestinationIP, flow.DestinationPort),
+		flow.Protocol,
+		bytes,
+	)
+}
+
+func summaryEndpoint(ip, port string) string {
+	if port == "" {
+		return ip
+	}
+	return ip + "." + port
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// FlowFilter selects flows by port, protocol, flow type, direction, byte count,
+// packet count, source or destination prefix, and the tags or user of the
+// devices at either end. The zero value matches every flow.
+type FlowFilter struct {
+	// Ports matches a flow whose source or destination port is in the set
+	Ports map[string]bool
+	// Protocols holds lowercase protocol names (tcp) or numbers (6)
+	Protocols map[string]bool
+	// FlowTypes holds FlowTypeVirtual, FlowTypeSubnet, FlowTypeExit or FlowTypePhysical
+	FlowTypes map[string]bool
+	// Directions holds lowercase flow directions; a value that is not a known
+	// direction matches nothing
+	Directions map[string]bool
+	MinBytes   int64
+	// MaxBytes of 0 means no upper bound
+	MaxBytes   int64
+	MinPackets int64
+	// MaxPackets of 0 means no upper bound
+	MaxPackets int64
+	// ExcludeUnknownProtocol drops protocol 0 flows
+	ExcludeUnknownProtocol bool
+	// SourceCIDRs and DestCIDRs match a flow whose source or destination IP
+	// falls in any of the prefixes
+	SourceCIDRs []netip.Prefix
+	DestCIDRs   []netip.Prefix
+	// Tags and Users match a flow whose source or destination device has any
+	// of the tags (case-sensitive, as in Tailscale ACLs) or belongs to any of
+	// the users (lowercase login names). They need the device list; see
+	// SetDevices.
+	Tags  map[string]bool
+	Users map[string]bool
+
+	owners map[string]Device
+}
+
+// IsZero reports whether the filter matches every flow
+func (f FlowFilter) IsZero() bool {
+	return len(f.Ports) == 0 && len(f.Protocols) == 0 && len(f.FlowTypes) == 0 && len(f.Directions) == 0 &&
+		f.MinBytes == 0 && f.MaxBytes == 0 && f.MinPackets == 0 && f.MaxPackets == 0 &&
+		!f.ExcludeUnknownProtocol && len(f.SourceCIDRs) == 0 && len(f.DestCIDRs) == 0 &&
+		!f.NeedsDevices()
+}
+
+// NeedsDevices reports whether the filter matches on device tags or users, and
+// so must be given the device list with SetDevices before use
+func (f FlowFilter) NeedsDevices() bool {
+	return len(f.Tags) > 0 || len(f.Users) > 0
+}
+
+// SetDevices gives the filter the devices whose tags and users it matches.
+// Flow endpoints owned by none of them match no tag or user.
+func (f *FlowFilter) SetDevices(devices []Device) {
+	f.owners = devicesByAddress(devices)
+}
+
+// Match reports whether flow passes every condition of the filter
+func (f FlowFilter) Match(flow RawFlowEntry) bool {
+	if f.ExcludeUnknownProtocol && flow.ProtocolNumber == 0 {
+		return false
+	}
+	if len(f.Ports) > 0 && !f.Ports[flow.SourcePort] && !f.Ports[flow.DestinationPort] {
+		return false
+	}
+	if len(f.Protocols) > 0 && !f.Protocols[strings.ToLower(flow.Protocol)] && !f.Protocols[strconv.Itoa(flow.ProtocolNumber)] {
+		return false
+	}
+	if len(f.FlowTypes) > 0 && !f.FlowTypes[flow.FlowType] {
+		return false
+	}
+	if len(f.Directions) > 0 && !f.Directions[flow.Direction] {
+		return false
+	}
+	if flow.TotalBytes < f.MinBytes {
+		return false
+	}
+	if f.MaxBytes > 0 && flow.TotalBytes > f.MaxBytes {
+		return false
+	}
+	if flow.TotalPackets < f.MinPackets {
+		return false
+	}
+	if f.MaxPackets > 0 && flow.TotalPackets > f.MaxPackets {
+		return false
+	}
+	if len(f.SourceCIDRs) > 0 && !prefixesContain(f.SourceCIDRs, flow.SourceIP) {
+		return false
+	}
+	if len(f.DestCIDRs) > 0 && !prefixesContain(f.DestCIDRs, flow.DestinationIP) {
+		return false
+	}
+	if f.NeedsDevices() && !f.ownerMatches(flow.SourceIP) && !f.ownerMatches(flow.DestinationIP) {
+		return false
+	}
+	return true
+}
+
+// ownerMatches reports whether the device owning ip has one of the filter's
+// tags or belongs to one of its users
+func (f FlowFilter) ownerMatches(ip string) bool {
+	device, ok := f.owners[ip]
+	if !ok {
+		return false
+	}
+	if f.Users[strings.ToLower(device.User)] {
+		return true
+	}
+	for _, tag := range device.Tags {
+		if f.Tags[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// KnownProtocol reports whether a lowercase protocol filter value can match a
+// flow: a number from 0 to 255 or the name a flow would carry for one
+func KnownProtocol(name string) bool {
+	if n, err := strconv.Atoi(name); err == nil {
+		return n >= 0 && n <= 255
+	}
+	for proto := 0; proto <= 255; proto++ {
+		if strings.ToLower(getProtocolName(proto)) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixesContain reports whether ip is in any of prefixes. An IPv4-mapped
+// IPv6 address matches IPv4 prefixes.
+func prefixesContain(prefixes []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterRawFlows returns the flows matching f
+func FilterRawFlows(flows []RawFlowEntry, f FlowFilter) []RawFlowEntry {
+	if f.IsZero() {
+		return flows
+	}
+	kept := make([]RawFlowEntry, 0, len(flows))
+	for _, flow := range flows {
+		if f.Match(flow) {
+			kept = append(kept, flow)
+		}
+	}
+	return kept
+}
+
+// FilterNetworkLogs decodes network logs, as generic JSON values or FlowLogs,
+// and keeps only the traffic records matching f.
+// Logs left with no traffic are dropped.
+func FilterNetworkLogs(logs interface{}, f FlowFilter) ([]FlowLog, error) {
+	data, err := json.Marshal(logs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode network logs: %w", err)
+	}
+	var flowLogs []FlowLog
+	if err := json.Unmarshal(data, &flowLogs); err != nil {
+		return nil, fmt.Errorf("failed to decode network logs: %w", err)
+	}
+
+	kept := make([]FlowLog, 0, len(flowLogs))
+	for _, flowLog := range flowLogs {
+		index := 0
+		keep := func(flowType string, flows []TrafficFlow) []TrafficFlow {
+			var matched []TrafficFlow
+			for _, flow := range flows {
+				if f.Match(createRawFlowEntry(flowLog, flow, flowType, index)) {
+					matched = append(matched, flow)
+				}
+				index++
+			}
+			return matched
+		}
+		flowLog.VirtualTraffic = keep(FlowTypeVirtual, flowLog.VirtualTraffic)
+		flowLog.SubnetTraffic = keep(FlowTypeSubnet, flowLog.SubnetTraffic)
+		flowLog.ExitTraffic = keep(FlowTypeExit, flowLog.ExitTraffic)
+		flowLog.PhysicalTraffic = keep(FlowTypePhysical, flowLog.PhysicalTraffic)
+
+		if len(flowLog.VirtualTraffic)+len(flowLog.SubnetTraffic)+len(flowLog.ExitTraffic)+len(flowLog.PhysicalTraffic) > 0 {
+			kept = append(kept, flowLog)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestPacketCountFilter(t *testing.T) {
+	flows := []RawFlowEntry{{ID: "busy", TotalPackets: 100, TotalBytes: 4000}}
+
+	tests := []struct {
+		name   string
+		filter FlowFilter
+		want   bool
+	}{
+		{"min below", FlowFilter{MinPackets: 50}, true},
+		{"min equal", FlowFilter{MinPackets: 100}, true},
+		{"min above", FlowFilter{MinPackets: 200}, false},
+		{"max above", FlowFilter{MaxPackets: 200}, true},
+		{"max below", FlowFilter{MaxPackets: 50}, false},
+		{"within range", FlowFilter{MinPackets: 50, MaxPackets: 150}, true},
+		{"few bytes, many packets", FlowFilter{MaxBytes: 5000, MinPackets: 50}, true},
+	}
+	for _, tt := range tests {
+		if tt.filter.IsZero() {
+			t.Errorf("%s: filter reports itself empty", tt.name)
+		}
+		if got := len(FilterRawFlows(flows, tt.filter)) == 1; got != tt.want {
+			t.Errorf("%s: kept %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCIDRFilter(t *testing.T) {
+	flows := []RawFlowEntry{
+		{ID: "v4", SourceIP: "100.64.0.1", DestinationIP: "10.0.1.20"},
+		{ID: "v4-other", SourceIP: "100.64.0.2", DestinationIP: "192.168.1.5"},
+		{ID: "v6", SourceIP: "fd7a:115c:a1e0::1", DestinationIP: "fd7a:115c:a1e0::2"},
+		{ID: "no-ip", SourceIP: "", DestinationIP: ""},
+	}
+	prefixes := func(cidrs ...string) []netip.Prefix {
+		var out []netip.Prefix
+		for _, cidr := range cidrs {
+			out = append(out, netip.MustParsePrefix(cidr))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		filter FlowFilter
+		want   []string
+	}{
+		{"IPv4 destination", FlowFilter{DestCIDRs: prefixes("10.0.0.0/16")}, []string{"v4"}},
+		{"IPv4 source", FlowFilter{SourceCIDRs: prefixes("100.64.0.2/32")}, []string{"v4-other"}},
+		{"IPv6 source", FlowFilter{SourceCIDRs: prefixes("fd7a:115c:a1e0::/48")}, []string{"v6"}},
+		{"any of several", FlowFilter{DestCIDRs: prefixes("192.168.0.0/16", "fd7a:115c:a1e0::2/128")}, []string{"v4-other", "v6"}},
+		{"source and destination", FlowFilter{SourceCIDRs: prefixes("100.64.0.0/10"), DestCIDRs: prefixes("10.0.0.0/8")}, []string{"v4"}},
+		{"IPv4 prefix does not match IPv6", FlowFilter{SourceCIDRs: prefixes("0.0.0.0/0")}, []string{"v4", "v4-other"}},
+	}
+	for _, tt := range tests {
+		got := FilterRawFlows(flows, tt.filter)
+		var ids []string
+		for _, flow := range got {
+			ids = append(ids, flow.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
+
+func TestDirectionFilter(t *testing.T) {
+	logged := FlowLog{NodeID: "n1"}
+	flows := []RawFlowEntry{
+		createRawFlowEntry(logged, TrafficFlow{Proto: 6, Src: "100.64.0.1:1", Dst: "100.64.0.2:2", TxPkts: 3, TxBytes: 300}, FlowTypeVirtual, 0),
+		createRawFlowEntry(logged, TrafficFlow{Proto: 6, Src: "100.64.0.1:1", Dst: "100.64.0.2:2", RxPkts: 3, RxBytes: 300}, FlowTypeVirtual, 1),
+		createRawFlowEntry(logged, TrafficFlow{Proto: 6, Src: "100.64.0.1:1", Dst: "100.64.0.2:2", TxPkts: 1, RxPkts: 1}, FlowTypeVirtual, 2),
+	}
+	for i, want := range []string{FlowDirectionOutbound, FlowDirectionInbound, FlowDirectionBidirectional} {
+		if flows[i].Direction != want {
+			t.Errorf("flow %d direction %q, want %q", i, flows[i].Direction, want)
+		}
+	}
+
+	tests := []struct {
+		directions []string
+		want       int
+	}{
+		{nil, 3},
+		{[]string{"inbound"}, 1},
+		{[]string{"inbound", "outbound"}, 2},
+		{[]string{"sideways"}, 0},
+	}
+	for _, tt := range tests {
+		var filter FlowFilter
+		if tt.directions != nil {
+			filter.Directions = make(map[string]bool)
+			for _, d := range tt.directions {
+				filter.Directions[d] = true
+			}
+		}
+		if got := len(FilterRawFlows(flows, filter)); got != tt.want {
+			t.Errorf("directions %v: kept %d flows, want %d", tt.directions, got, tt.want)
+		}
+	}
+}
+
+func TestTagAndUserFilter(t *testing.T) {
+	devices := []Device{
+		{ID: "web", Addresses: []string{"100.64.0.1"}, Tags: []string{"tag:server"}, User: "ops@example.com"},
+		{ID: "laptop", Addresses: []string{"100.64.0.2"}, User: "Alice@example.com"},
+		{ID: "db", Addresses: []string{"100.64.0.3"}, Tags: []string{"tag:db", "tag:server"}},
+	}
+	flows := []RawFlowEntry{
+		{ID: "laptop-web", SourceIP: "100.64.0.2", DestinationIP: "100.64.0.1"},
+		{ID: "web-db", SourceIP: "100.64.0.1", DestinationIP: "100.64.0.3"},
+		{ID: "laptop-internet", SourceIP: "100.64.0.2", DestinationIP: "1.1.1.1"},
+		{ID: "unknown", SourceIP: "10.0.0.5", DestinationIP: "1.1.1.1"},
+	}
+	set := func(values ...string) map[string]bool {
+		m := make(map[string]bool)
+		for _, v := range values {
+			m[v] = true
+		}
+		return m
+	}
+
+	tests := []struct {
+		name   string
+		filter FlowFilter
+		want   []string
+	}{
+		{"tag on either side", FlowFilter{Tags: set("tag:server")}, []string{"laptop-web", "web-db"}},
+		{"tag on destination only", FlowFilter{Tags: set("tag:db")}, []string{"web-db"}},
+		{"tags are case-sensitive", FlowFilter{Tags: set("tag:Server")}, nil},
+		{"user", FlowFilter{Users: set("alice@example.com")}, []string{"laptop-web", "laptop-internet"}},
+		{"tag or user", FlowFilter{Tags: set("tag:db"), Users: set("alice@example.com")}, []string{"laptop-web", "web-db", "laptop-internet"}},
+		{"unknown tag", FlowFilter{Tags: set("tag:nothing")}, nil},
+		{"no filter", FlowFilter{}, []string{"laptop-web", "web-db", "laptop-internet", "unknown"}},
+	}
+	for _, tt := range tests {
+		filter := tt.filter
+		filter.SetDevices(devices)
+		var ids []string
+		for _, flow := range FilterRawFlows(flows, filter) {
+			ids = append(ids, flow.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
@@ -0,0 +1,636 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajsinghtech/tsflow/backend/internal/utils"
+)
+
+// ErrDeviceNotFound is returned when a device ID does not exist in the tailnet
+var ErrDeviceNotFound = errors.New("device not found")
+
+// Flow types as reported by the Tailscale network logs API
+const (
+	FlowTypeVirtual  = "virtual"
+	FlowTypeSubnet   = "subnet"
+	FlowTypeExit     = "exit"
+	FlowTypePhysical = "physical"
+)
+
+// Flow directions, from the point of view of the node that logged the flow
+const (
+	FlowDirectionOutbound      = "outbound"
+	FlowDirectionInbound       = "inbound"
+	FlowDirectionBidirectional = "bidirectional"
+)
+
+// FlowLog is a single network flow log entry as returned by the Tailscale API
+type FlowLog struct {
+	Logged          time.Time     `json:"logged"`
+	NodeID          string        `json:"nodeId"`
+	Start           time.Time     `json:"start"`
+	End             time.Time     `json:"end"`
+	VirtualTraffic  []TrafficFlow `json:"virtualTraffic,omitempty"`
+	SubnetTraffic   []TrafficFlow `json:"subnetTraffic,omitempty"`
+	ExitTraffic     []TrafficFlow `json:"exitTraffic,omitempty"`
+	PhysicalTraffic []TrafficFlow `json:"physicalTraffic,omitempty"`
+}
+
+// TrafficFlow holds the counters for one src/dst pair within a flow log
+type TrafficFlow struct {
+	Proto   int    `json:"proto"`
+	Src     string `json:"src"`
+	Dst     string `json:"dst"`
+	TxPkts  int64  `json:"txPkts"`
+	TxBytes int64  `json:"txBytes"`
+	RxPkts  int64  `json:"rxPkts"`
+	RxBytes int64  `json:"rxBytes"`
+}
+
+// RawFlowEntry is a flattened, parsed traffic flow
+type RawFlowEntry struct {
+	ID              string    `json:"id"`
+	NodeID          string    `json:"nodeId"`
+	Timestamp       time.Time `json:"timestamp"`
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	SourceIP        string    `json:"srcIP"`
+	SourcePort      string    `json:"srcPort,omitempty"`
+	DestinationIP   string    `json:"dstIP"`
+	DestinationPort string    `json:"dstPort,omitempty"`
+	Protocol        string    `json:"protocol"`
+	ProtocolNumber  int       `json:"protocolNumber"`
+	TxBytes         int64     `json:"txBytes"`
+	RxBytes         int64     `json:"rxBytes"`
+	TotalBytes      int64     `json:"totalBytes"`
+	TxPackets       int64     `json:"txPackets"`
+	RxPackets       int64     `json:"rxPackets"`
+	TotalPackets    int64     `json:"totalPackets"`
+	FlowType        string    `json:"flowType"`
+	// Direction is FlowDirectionOutbound when the logging node only sent,
+	// FlowDirectionInbound when it only received, FlowDirectionBidirectional
+	// when it did both, and empty for a flow with no packets either way
+	Direction string `json:"direction,omitempty"`
+
+	// ICMPType and ICMPCode are reserved for ICMP and ICMPv6 flows. Tailscale
+	// flow logs do not carry either, so both are nil for now.
+	ICMPType *int `json:"icmpType,omitempty"`
+	ICMPCode *int `json:"icmpCode,omitempty"`
+
+	// Human-readable byte counts, set only when a client asks for them
+	TxBytesHuman    string `json:"txBytesHuman,omitempty"`
+	RxBytesHuman    string `json:"rxBytesHuman,omitempty"`
+	TotalBytesHuman string `json:"totalBytesHuman,omitempty"`
+
+	// SourceName and DestinationName are the owning device's MagicDNS name
+	// (e.g. host.tailnet.ts.net), else its hostname, else the IP itself
+	SourceName      string `json:"srcName"`
+	DestinationName string `json:"dstName"`
+
+	// DestinationService names the VIP service whose address is the destination
+	DestinationService string `json:"dstService,omitempty"`
+
+	// GeoIP data for public destinations, set when TSFLOW_GEOIP_DB is configured
+	DestinationCountry string `json:"dstCountry,omitempty"`
+	DestinationASN     uint   `json:"dstASN,omitempty"`
+}
+
+// GetFlowLogs fetches network logs for the time range and decodes them into FlowLogs
+func (ts *TailscaleService) GetFlowLogs(ctx context.Context, start, end time.Time) ([]FlowLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	var logs []FlowLog
+	err := ts.streamNetworkLogsRange(ctx, start, end, func(entry interface{}) error {
+		flowLog, err := toFlowLog(entry)
+		if err != nil {
+			return err
+		}
+		logs = append(logs, flowLog)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// GetRawFlows fetches network logs for the time range and flattens them into
+// flows. VIP services and devices are fetched alongside to name service
+// destinations and flow endpoints. Callers that already hold the device list
+// should use GetRawFlowsWithDevices instead.
+func (ts *TailscaleService) GetRawFlows(ctx context.Context, start, end time.Time) ([]RawFlowEntry, error) {
+	devicesDone := make(chan []Device, 1)
+	go func() {
+		devices, err := ts.GetDevices(ctx)
+		if err != nil {
+			log.Printf("%sWARNING flow name resolution disabled: %v", utils.LogPrefix(ctx), err)
+			devicesDone <- nil
+			return
+		}
+		devicesDone <- devices.Devices
+	}()
+	return ts.getRawFlows(ctx, start, end, devicesDone)
+}
+
+// GetRawFlowsWithDevices is GetRawFlows naming flow endpoints from devices
+// rather than fetching the device list again
+func (ts *TailscaleService) GetRawFlowsWithDevices(ctx context.Context, start, end time.Time, devices []Device) ([]RawFlowEntry, error) {
+	devicesDone := make(chan []Device, 1)
+	devicesDone <- devices
+	return ts.getRawFlows(ctx, start, end, devicesDone)
+}
+
+// getRawFlows fetches and flattens the logs, then names the flows once the
+// device list arrives on devicesDone
+func (ts *TailscaleService) getRawFlows(ctx context.Context, start, end time.Time, devicesDone <-chan []Device) ([]RawFlowEntry, error) {
+	vipDone := make(chan map[string]VIPServiceInfo, 1)
+	go func() {
+		vips, err := ts.GetVIPServices(ctx)
+		var apiErr *utils.APIError
+		// A 404 only means the tailnet has no VIP services
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == 404) {
+			log.Printf("%sWARNING VIP service resolution disabled: %v", utils.LogPrefix(ctx), err)
+		}
+		vipDone <- vips
+	}()
+
+	logs, err := ts.GetFlowLogs(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := ts.processFlowLogs(logs)
+	resolveVIPServices(entries, vipAddressIndex(<-vipDone))
+	resolveFlowNames(entries, devicesByAddress(<-devicesDone))
+	return entries, nil
+}
+
+// vipAddressIndex maps each VIP service address to the service name
+func vipAddressIndex(vips map[string]VIPServiceInfo) map[string]string {
+	index := make(map[string]string)
+	for name, svc := range vips {
+		for _, addr := range svc.Addrs {
+			ip, _, _ := strings.Cut(addr, "/")
+			index[ip] = name
+		}
+	}
+	return index
+}
+
+// resolveVIPServices sets DestinationService on flows addressed to a VIP service
+func resolveVIPServices(entries []RawFlowEntry, index map[string]string) {
+	if len(index) == 0 {
+		return
+	}
+	for i := range entries {
+		if name, ok := index[entries[i].DestinationIP]; ok {
+			entries[i].DestinationService = name
+		}
+	}
+}
+
+// resolveFlowNames sets SourceName and DestinationName on each flow
+func resolveFlowNames(entries []RawFlowEntry, owners map[string]Device) {
+	for i := range entries {
+		entries[i].SourceName = flowEndpointName(entries[i].SourceIP, owners)
+		entries[i].DestinationName = flowEndpointName(entries[i].DestinationIP, owners)
+	}
+}
+
+// flowEndpointName names ip by its owning device: the MagicDNS name the API
+// reports as the device name, else the hostname, else the IP
+func flowEndpointName(ip string, owners map[string]Device) string {
+	device, ok := owners[ip]
+	switch {
+	case ok && device.Name != "":
+		return device.Name
+	case ok && device.Hostname != "":
+		return device.Hostname
+	default:
+		return ip
+	}
+}
+
+// toFlowLog converts a log entry decoded from the API as a generic JSON map
+// into a FlowLog
+func toFlowLog(entry interface{}) (FlowLog, error) {
+	var flowLog FlowLog
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return flowLog, fmt.Errorf("failed to encode network log: %w", err)
+	}
+	if err := json.Unmarshal(data, &flowLog); err != nil {
+		return flowLog, fmt.Errorf("failed to decode network log: %w", err)
+	}
+	return flowLog, nil
+}
+
+// ProcessFlowLogs flattens flow logs into one RawFlowEntry per traffic record
+func ProcessFlowLogs(logs []FlowLog) []RawFlowEntry {
+	var entries []RawFlowEntry
+	for _, flowLog := range logs {
+		index := 0
+		for _, traffic := range []struct {
+			flowType string
+			flows    []TrafficFlow
+		}{
+			{FlowTypeVirtual, flowLog.VirtualTraffic},
+			{FlowTypeSubnet, flowLog.SubnetTraffic},
+			{FlowTypeExit, flowLog.ExitTraffic},
+			{FlowTypePhysical, flowLog.PhysicalTraffic},
+		} {
+			for _, flow := range traffic.flows {
+				entries = append(entries, createRawFlowEntry(flowLog, flow, traffic.flowType, index))
+				index++
+			}
+		}
+	}
+	return entries
+}
+
+// processFlowLogs flattens flow logs and applies the service's enrichments
+func (ts *TailscaleService) processFlowLogs(logs []FlowLog) []RawFlowEntry {
+	entries := ProcessFlowLogs(logs)
+	ts.geoIP.Enrich(entries)
+	return entries
+}
+
+func createRawFlowEntry(flowLog FlowLog, flow TrafficFlow, flowType string, index int) RawFlowEntry {
+	srcIP, srcPort := parseAddress(flow.Src)
+	dstIP, dstPort := parseAddress(flow.Dst)
+
+	// ICMP has no ports, so the port position is never reported as one
+	if isICMP(flow.Proto) {
+		srcPort, dstPort = "", ""
+	}
+
+	return RawFlowEntry{
+		ID:              fmt.Sprintf("%s-%d-%d", flowLog.NodeID, flowLog.Start.UnixNano(), index),
+		NodeID:          flowLog.NodeID,
+		Timestamp:       flowLog.Start,
+		StartTime:       flowLog.Start,
+		EndTime:         flowLog.End,
+		SourceIP:        srcIP,
+		SourcePort:      srcPort,
+		DestinationIP:   dstIP,
+		DestinationPort: dstPort,
+		Protocol:        getProtocolName(flow.Proto),
+		ProtocolNumber:  flow.Proto,
+		TxBytes:         flow.TxBytes,
+		RxBytes:         flow.RxBytes,
+		TotalBytes:      flow.TxBytes + flow.RxBytes,
+		TxPackets:       flow.TxPkts,
+		RxPackets:       flow.RxPkts,
+		TotalPackets:    flow.TxPkts + flow.RxPkts,
+		FlowType:        flowType,
+		Direction:       flowDirection(flow),
+	}
+}
+
+// flowDirection classifies flow by which way the logging node moved packets
+func flowDirection(flow TrafficFlow) string {
+	sent := flow.TxPkts > 0 || flow.TxBytes > 0
+	received := flow.RxPkts > 0 || flow.RxBytes > 0
+	switch {
+	case sent && received:
+		return FlowDirectionBidirectional
+	case sent:
+		return FlowDirectionOutbound
+	case received:
+		return FlowDirectionInbound
+	default:
+		return ""
+	}
+}
+
+// parseAddress splits a flow address into IP and port. It accepts "ip:port",
+// "[ipv6]:port", bare IPv4 and bare (bracketless) IPv6 literals, each with an
+// optional IPv6 zone. Addresses come from upstream logs, so it never panics on
+// malformed input and guarantees that ip is either empty or a valid IP in
+// canonical form with any zone removed, and port is either empty or a decimal
+// number from 0 to 65535.
+func parseAddress(addr string) (ip, port string) {
+	host := addr
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+	// SplitHostPort rejects bare IPv6 literals and "[ipv6]" without a port
+	if parsed, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		ip = parsed.WithZone("").String()
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err == nil {
+		return ip, strconv.FormatUint(n, 10)
+	}
+	return ip, ""
+}
+
+// HumanizeBytes fills in the human-readable byte count fields of each flow
+func HumanizeBytes(flows []RawFlowEntry) {
+	for i := range flows {
+		flows[i].TxBytesHuman = utils.FormatBytes(flows[i].TxBytes)
+		flows[i].RxBytesHuman = utils.FormatBytes(flows[i].RxBytes)
+		flows[i].TotalBytesHuman = utils.FormatBytes(flows[i].TotalBytes)
+	}
+}
+
+// isICMP reports whether proto is ICMP (1) or ICMPv6 (58)
+func isICMP(proto int) bool {
+	return proto == 1 || proto == 58
+}
+
+// UnknownProtocol labels protocol 0, which flow logs use for traffic whose
+// layer 4 protocol was not recorded (HOPOPT is never seen in practice)
+const UnknownProtocol = "unknown"
+
+// getProtocolName maps an IP protocol number to its common name
+func getProtocolName(proto int) string {
+	switch proto {
+	case 0:
+		return UnknownProtocol
+	case 1:
+		return "ICMP"
+	case 2:
+		return "IGMP"
+	case 6:
+		return "TCP"
+	case 17:
+		return "UDP"
+	case 47:
+		return "GRE"
+	case 50:
+		return "ESP"
+	case 51:
+		return "AH"
+	case 58:
+		return "ICMPv6"
+	case 132:
+		return "SCTP"
+	case 255:
+		return "RAW"
+	default:
+		return fmt.Sprintf("proto-%d", proto)
+	}
+}
+
+// deviceAddressSet returns the device's tailnet IPs without any CIDR suffix
+func deviceAddressSet(device Device) map[string]bool {
+	addresses := make(map[string]bool, len(device.Addresses))
+	for _, addr := range device.Addresses {
+		ip, _, _ := strings.Cut(addr, "/")
+		addresses[ip] = true
+	}
+	return addresses
+}
+
+// devicesByAddress maps each tailnet IP to the device that owns it. If two
+// devices list the same address, the first one wins.
+func devicesByAddress(devices []Device) map[string]Device {
+	owners := make(map[string]Device)
+	for _, device := range devices {
+		for ip := range deviceAddressSet(device) {
+			if _, ok := owners[ip]; !ok {
+				owners[ip] = device
+			}
+		}
+	}
+	return owners
+}
+
+const (
+	// maxFlowFilterWorkers caps the goroutines filterDeviceFlows uses
+	maxFlowFilterWorkers = 8
+	// minFlowsPerWorker keeps small inputs from paying goroutine overhead
+	minFlowsPerWorker = 10000
+	// flowFilterCheckInterval is how many flows a worker scans between context checks
+	flowFilterCheckInterval = 4096
+)
+
+// filterDeviceFlows returns the entries with a source or destination in
+// addresses, preserving input order. Large inputs are partitioned across a
+// bounded number of workers; all of them stop once ctx is done.
+func filterDeviceFlows(ctx context.Context, entries []RawFlowEntry, addresses map[string]bool) ([]RawFlowEntry, error) {
+	workers := min(runtime.GOMAXPROCS(0), maxFlowFilterWorkers, len(entries)/minFlowsPerWorker)
+	if workers < 1 {
+		workers = 1
+	}
+
+	chunkSize := (len(entries) + workers - 1) / workers
+	results := make([][]RawFlowEntry, workers)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo := w * chunkSize
+		hi := min(lo+chunkSize, len(entries))
+		if lo >= hi {
+			continue
+		}
+
+		wg.Add(1)
+		go func(w int, chunk []RawFlowEntry) {
+			defer wg.Done()
+			var matches []RawFlowEntry
+			for i, entry := range chunk {
+				if i%flowFilterCheckInterval == 0 {
+					if err := ctx.Err(); err != nil {
+						errs[w] = err
+						return
+					}
+				}
+				if addresses[entry.SourceIP] || addresses[entry.DestinationIP] {
+					matches = append(matches, entry)
+				}
+			}
+			results[w] = matches
+		}(w, entries[lo:hi])
+	}
+	wg.Wait()
+
+	flows := []RawFlowEntry{}
+	for w := range results {
+		if errs[w] != nil {
+			return nil, errs[w]
+		}
+		flows = append(flows, results[w]...)
+	}
+	return flows, nil
+}
+
+// GetIPFlows returns the traffic flows in the time range where ip is the
+// source or destination, for addresses that may not belong to any device. ip
+// must be in canonical form, as parseAddress produces. The result names the
+// device owning ip, if any, and the subnet routers with an enabled route
+// covering it; default routes are left out, so exit nodes are not listed.
+func (ts *TailscaleService) GetIPFlows(ctx context.Context, ip netip.Addr, start, end time.Time) (map[string]interface{}, error) {
+	devices, err := ts.GetDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ts.GetRawFlowsWithDevices(ctx, start, end, devices.Devices)
+	if err != nil {
+		return nil, err
+	}
+
+	flows, err := filterDeviceFlows(ctx, entries, map[string]bool{ip.String(): true})
+	if err != nil {
+		return nil, err
+	}
+
+	var totalBytes, totalPackets int64
+	for _, flow := range flows {
+		totalBytes += flow.TotalBytes
+		totalPackets += flow.TotalPackets
+	}
+
+	var owner *Device
+	if device, ok := devicesByAddress(devices.Devices)[ip.String()]; ok {
+		owner = &device
+	}
+
+	return map[string]interface{}{
+		"ip":             ip.String(),
+		"device":         owner,
+		"subnet_routers": subnetRoutersFor(devices.Devices, ip),
+		"flows":          flows,
+		"total_flows":    len(flows),
+		"total_bytes":    totalBytes,
+		"total_packets":  totalPackets,
+		"time_range": map[string]string{
+			"start": start.Format(time.RFC3339),
+			"end":   end.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+// subnetRoutersFor returns the devices with an enabled, non-default route
+// containing ip
+func subnetRoutersFor(devices []Device, ip netip.Addr) []Device {
+	routers := []Device{}
+	for _, device := range devices {
+		for _, route := range device.EnabledRoutes {
+			prefix, err := netip.ParsePrefix(route)
+			if err != nil || prefix.Bits() == 0 {
+				continue
+			}
+			if prefix.Contains(ip) {
+				routers = append(routers, device)
+				break
+			}
+		}
+	}
+	return routers
+}
+
+// GetDevice returns the device with the given ID, or ErrDeviceNotFound
+func (ts *TailscaleService) GetDevice(ctx context.Context, deviceID string) (*Device, error) {
+	devices, err := ts.GetDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return FindDevice(devices.Devices, deviceID)
+}
+
+// FindDevice returns the device in devices with the given ID, or
+// ErrDeviceNotFound
+func FindDevice(devices []Device, deviceID string) (*Device, error) {
+	for i := range devices {
+		if devices[i].ID == deviceID {
+			return &devices[i], nil
+		}
+	}
+	return nil, ErrDeviceNotFound
+}
+
+// DeviceTrafficStats totals a device's traffic, counted from the device's side
+type DeviceTrafficStats struct {
+	BytesIn    int64 `json:"bytesIn"`
+	BytesOut   int64 `json:"bytesOut"`
+	PacketsIn  int64 `json:"packetsIn"`
+	PacketsOut int64 `json:"packetsOut"`
+	FlowCount  int   `json:"flowCount"`
+}
+
+// SummarizeDeviceTraffic totals the flows involving any of the device's
+// addresses. A flow's tx counters are outbound when the device is the source
+// and inbound when it is the destination; rx counters the reverse.
+func SummarizeDeviceTraffic(device Device, flows []RawFlowEntry) DeviceTrafficStats {
+	addresses := deviceAddressSet(device)
+	var stats DeviceTrafficStats
+	for _, flow := range flows {
+		isSource := addresses[flow.SourceIP]
+		isDestination := addresses[flow.DestinationIP]
+		if !isSource && !isDestination {
+			continue
+		}
+
+		stats.FlowCount++
+		if isSource {
+			stats.BytesOut += flow.TxBytes
+			stats.BytesIn += flow.RxBytes
+			stats.PacketsOut += flow.TxPackets
+			stats.PacketsIn += flow.RxPackets
+		}
+		if isDestination {
+			stats.BytesIn += flow.TxBytes
+			stats.BytesOut += flow.RxBytes
+			stats.PacketsIn += flow.TxPackets
+			stats.PacketsOut += flow.RxPackets
+		}
+	}
+	return stats
+}
+
+// GetDeviceFlows returns the traffic flows in the time range where any of the
+// device's addresses is the source or destination
+func (ts *TailscaleService) GetDeviceFlows(ctx context.Context, deviceID string, start, end time.Time) (map[string]interface{}, error) {
+	devices, err := ts.GetDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	device, err := FindDevice(devices.Devices, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ts.GetRawFlowsWithDevices(ctx, start, end, devices.Devices)
+	if err != nil {
+		return nil, err
+	}
+
+	flows, err := filterDeviceFlows(ctx, entries, deviceAddressSet(*device))
+	if err != nil {
+		return nil, err
+	}
+
+	var totalBytes, totalPackets int64
+	for _, flow := range flows {
+		totalBytes += flow.TotalBytes
+		totalPackets += flow.TotalPackets
+	}
+
+	return map[string]interface{}{
+		"device_id":     deviceID,
+		"device_name":   device.Name,
+		"flows":         flows,
+		"total_flows":   len(flows),
+		"total_bytes":   totalBytes,
+		"total_packets": totalPackets,
+		"time_range": map[string]string{
+			"start": start.Format(time.RFC3339),
+			"end":   end.Format(time.RFC3339),
+		},
+	}, nil
+}
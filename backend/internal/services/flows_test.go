@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetProtocolName(t *testing.T) {
+	tests := []struct {
+		proto int
+		want  string
+	}{
+		{0, UnknownProtocol},
+		{1, "ICMP"},
+		{2, "IGMP"},
+		{6, "TCP"},
+		{17, "UDP"},
+		{47, "GRE"},
+		{50, "ESP"},
+		{51, "AH"},
+		{58, "ICMPv6"},
+		{132, "SCTP"},
+		{255, "RAW"},
+		{41, "proto-41"},
+		{254, "proto-254"},
+	}
+	for _, tt := range tests {
+		if got := getProtocolName(tt.proto); got != tt.want {
+			t.Errorf("getProtocolName(%d) = %q, want %q", tt.proto, got, tt.want)
+		}
+	}
+}
+
+func TestProtocolFilterByName(t *testing.T) {
+	flows := []RawFlowEntry{
+		{ID: "tcp", Protocol: getProtocolName(6), ProtocolNumber: 6},
+		{ID: "gre", Protocol: getProtocolName(47), ProtocolNumber: 47},
+		{ID: "sctp", Protocol: getProtocolName(132), ProtocolNumber: 132},
+	}
+
+	tests := []struct {
+		protocols []string
+		want      []string
+	}{
+		{[]string{"tcp"}, []string{"tcp"}},
+		{[]string{"gre", "esp"}, []string{"gre"}},
+		{[]string{"132"}, []string{"sctp"}},
+	}
+	for _, tt := range tests {
+		filter := FlowFilter{Protocols: make(map[string]bool)}
+		for _, p := range tt.protocols {
+			filter.Protocols[p] = true
+		}
+		got := FilterRawFlows(flows, filter)
+		if len(got) != len(tt.want) {
+			t.Fatalf("protocols=%v: got %d flows, want %v", tt.protocols, len(got), tt.want)
+		}
+		for i, flow := range got {
+			if flow.ID != tt.want[i] {
+				t.Errorf("protocols=%v: flow %d is %q, want %q", tt.protocols, i, flow.ID, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		addr     string
+		wantIP   string
+		wantPort string
+	}{
+		{"[fd7a::1]:443", "fd7a::1", "443"},
+		{"fd7a::1", "fd7a::1", ""},
+		{"fd7a:115c:a1e0::1", "fd7a:115c:a1e0::1", ""},
+		{"100.64.0.1:22", "100.64.0.1", "22"},
+		{"100.64.0.1", "100.64.0.1", ""},
+		{"[fe80::1%eth0]:53", "fe80::1", "53"},
+		{"fe80::1%eth0", "fe80::1", ""},
+		{"100.64.0.1:99999", "100.64.0.1", ""},
+		{"", "", ""},
+		{"[]", "", ""},
+		{"[::]:", "::", ""},
+		{"not an address", "", ""},
+	}
+	for _, tt := range tests {
+		ip, port := parseAddress(tt.addr)
+		if ip != tt.wantIP || port != tt.wantPort {
+			t.Errorf("parseAddress(%q) = (%q, %q), want (%q, %q)", tt.addr, ip, port, tt.wantIP, tt.wantPort)
+		}
+	}
+}
+
+func FuzzParseAddress(f *testing.F) {
+	for _, seed := range []string{
+		"fd7a:115c:a1e0::1",
+		"[fd7a:115c:a1e0::1]:443",
+		"[fd7a::1]",
+		"fe80::1%eth0",
+		"[fe80::1%eth0]:53",
+		"100.64.0.1:22",
+		"::ffff:100.64.0.1",
+		"",
+		":",
+		"[]",
+		"[::]:",
+		"100.64.0.1:-1",
+		"100.64.0.1:65536",
+		"garbage",
+		"[[::1]]:80:80",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, addr string) {
+		ip, port := parseAddress(addr)
+		if ip != "" {
+			parsed, err := netip.ParseAddr(ip)
+			if err != nil {
+				t.Fatalf("parseAddress(%q) ip %q does not parse: %v", addr, ip, err)
+			}
+			if parsed.Zone() != "" || parsed.String() != ip {
+				t.Fatalf("parseAddress(%q) ip %q is not canonical (%q)", addr, ip, parsed)
+			}
+		}
+		if port != "" {
+			n, err := strconv.ParseUint(port, 10, 16)
+			if err != nil || strconv.FormatUint(n, 10) != port {
+				t.Fatalf("parseAddress(%q) port %q is not a number from 0 to 65535", addr, port)
+			}
+		}
+	})
+}
+
+func TestCreateRawFlowEntryICMP(t *testing.T) {
+	tests := []struct {
+		name string
+		flow TrafficFlow
+	}{
+		{"icmp without port", TrafficFlow{Proto: 1, Src: "100.64.0.1", Dst: "100.64.0.2"}},
+		{"icmp with zero port", TrafficFlow{Proto: 1, Src: "100.64.0.1:0", Dst: "100.64.0.2:0"}},
+		{"icmp with nonzero port", TrafficFlow{Proto: 1, Src: "100.64.0.1:0", Dst: "100.64.0.2:2048"}},
+		{"icmpv6", TrafficFlow{Proto: 58, Src: "[fd7a::1]:0", Dst: "[fd7a::2]:32768"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := createRawFlowEntry(FlowLog{NodeID: "n1"}, tt.flow, FlowTypeVirtual, 0)
+			if entry.SourcePort != "" || entry.DestinationPort != "" {
+				t.Errorf("ports = %q, %q, want none", entry.SourcePort, entry.DestinationPort)
+			}
+			if entry.ICMPType != nil || entry.ICMPCode != nil {
+				t.Errorf("type/code = %v/%v, want nil", entry.ICMPType, entry.ICMPCode)
+			}
+		})
+	}
+
+	tcp := createRawFlowEntry(FlowLog{}, TrafficFlow{Proto: 6, Src: "100.64.0.1:50000", Dst: "100.64.0.2:2048"}, FlowTypeVirtual, 0)
+	if tcp.DestinationPort != "2048" {
+		t.Errorf("tcp flow: port %q, want 2048", tcp.DestinationPort)
+	}
+}
+
+// syntheticFlows returns n flows spread over 256 source addresses, so a
+// single-address filter matches about 1 in 256
+func syntheticFlows(n int) []RawFlowEntry {
+	flows := make([]RawFlowEntry, n)
+	for i := range flows {
+		flows[i] = RawFlowEntry{
+			ID:            strconv.Itoa(i),
+			SourceIP:      fmt.Sprintf("100.64.0.%d", i%256),
+			DestinationIP: "100.64.1.1",
+		}
+	}
+	return flows
+}
+
+// filterDeviceFlowsSerial is the single-goroutine scan filterDeviceFlows replaced
+func filterDeviceFlowsSerial(entries []RawFlowEntry, addresses map[string]bool) []RawFlowEntry {
+	flows := []RawFlowEntry{}
+	for _, entry := range entries {
+		if addresses[entry.SourceIP] || addresses[entry.DestinationIP] {
+			flows = append(flows, entry)
+		}
+	}
+	return flows
+}
+
+func TestFilterDeviceFlowsMatchesSerialScan(t *testing.T) {
+	addresses := map[string]bool{"100.64.0.7": true}
+	for _, n := range []int{0, 1, minFlowsPerWorker - 1, 3*minFlowsPerWorker + 17} {
+		flows := syntheticFlows(n)
+		got, err := filterDeviceFlows(context.Background(), flows, addresses)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := filterDeviceFlowsSerial(flows, addresses)
+		if len(got) != len(want) {
+			t.Fatalf("n=%d: got %d flows, want %d", n, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID {
+				t.Fatalf("n=%d: flow %d is %s, want %s", n, i, got[i].ID, want[i].ID)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := filterDeviceFlows(ctx, syntheticFlows(10), addresses); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled filter: err = %v, want context.Canceled", err)
+	}
+}
+
+func BenchmarkFilterDeviceFlows(b *testing.B) {
+	addresses := map[string]bool{"100.64.0.7": true}
+	for _, n := range []int{1000, 10000, 100000, 1000000} {
+		flows := syntheticFlows(n)
+		b.Run(fmt.Sprintf("workers/n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := filterDeviceFlows(context.Background(), flows, addresses); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("serial/n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				filterDeviceFlowsSerial(flows, addresses)
+			}
+		})
+	}
+}
+
+func TestHumanizeBytesKeepsNumericFields(t *testing.T) {
+	flows := []RawFlowEntry{{TxBytes: 1023, RxBytes: 1024, TotalBytes: 2047}}
+	HumanizeBytes(flows)
+
+	f := flows[0]
+	if f.TxBytes != 1023 || f.RxBytes != 1024 || f.TotalBytes != 2047 {
+		t.Errorf("numeric fields changed: %+v", f)
+	}
+	if f.TxBytesHuman != "1023 B" || f.RxBytesHuman != "1.0 KiB" || f.TotalBytesHuman != "2.0 KiB" {
+		t.Errorf("human fields = %q, %q, %q", f.TxBytesHuman, f.RxBytesHuman, f.TotalBytesHuman)
+	}
+}
+
+func TestGetRawFlowsNamesEndpoints(t *testing.T) {
+	ts := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/devices":
+			w.Write([]byte(`{"devices":[
+				{"id":"1","name":"web.tail1234.ts.net","hostname":"web","addresses":["100.64.0.1","fd7a:115c:a1e0::1"]},
+				{"id":"2","name":"","hostname":"db","addresses":["100.64.0.2"]}
+			]}`))
+		case "/api/v2/tailnet/example.com/logging/network":
+			w.Write([]byte(`{"logs":[{"nodeId":"n1","start":"2025-06-01T00:00:00Z","end":"2025-06-01T00:00:05Z","virtualTraffic":[
+				{"proto":6,"src":"100.64.0.1:443","dst":"100.64.0.2:5432","txBytes":10},
+				{"proto":6,"src":"[fd7a:115c:a1e0::1]:443","dst":"100.64.0.9:80","txBytes":10}
+			]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	flows, err := ts.GetRawFlows(context.Background(), start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("got %d flows, want 2", len(flows))
+	}
+
+	want := [][2]string{
+		{"web.tail1234.ts.net", "db"},
+		{"web.tail1234.ts.net", "100.64.0.9"},
+	}
+	for i, w := range want {
+		if flows[i].SourceName != w[0] || flows[i].DestinationName != w[1] {
+			t.Errorf("flow %d named %q -> %q, want %q -> %q", i, flows[i].SourceName, flows[i].DestinationName, w[0], w[1])
+		}
+	}
+}
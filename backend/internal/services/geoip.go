@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	// Tailscale's CGNAT range for IPv4 tailnet addresses
+	cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+	// Tailscale's ULA range for IPv6 tailnet addresses
+	tailnetIPv6Prefix = netip.MustParsePrefix("fd7a:115c:a1e0::/48")
+)
+
+// geoIPRecord holds the fields read from a MaxMind database. Country and ASN
+// databases each fill in only their own fields.
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN uint `maxminddb:"autonomous_system_number"`
+}
+
+// GeoIPResolver enriches flows to public destinations with country and ASN data
+type GeoIPResolver struct {
+	db *maxminddb.Reader
+}
+
+// NewGeoIPResolver opens the MaxMind mmdb file at path
+func NewGeoIPResolver(path string) (*GeoIPResolver, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %w", path, err)
+	}
+	return &GeoIPResolver{db: db}, nil
+}
+
+// Enrich sets DestinationCountry and DestinationASN on flows whose destination is a
+// public IP. Each distinct IP is looked up once per call. A nil resolver is a no-op.
+func (g *GeoIPResolver) Enrich(entries []RawFlowEntry) {
+	if g == nil {
+		return
+	}
+
+	cache := make(map[string]geoIPRecord)
+	for i := range entries {
+		ip := entries[i].DestinationIP
+		record, seen := cache[ip]
+		if !seen {
+			if addr, err := netip.ParseAddr(ip); err == nil && isPublicIP(addr) {
+				// A failed lookup leaves the record empty, which is cached too
+				_ = g.db.Lookup(net.IP(addr.AsSlice()), &record)
+			}
+			cache[ip] = record
+		}
+
+		entries[i].DestinationCountry = record.Country.ISOCode
+		entries[i].DestinationASN = record.ASN
+	}
+}
+
+// isPublicIP reports whether addr is routable on the internet, i.e. not a
+// private, CGNAT, tailnet, loopback or link-local address
+func isPublicIP(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!cgnatPrefix.Contains(addr) &&
+		!tailnetIPv6Prefix.Contains(addr)
+}
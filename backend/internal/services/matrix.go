@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MaxMatrixDevices caps the dimension of a device pair matrix
+const MaxMatrixDevices = 200
+
+// MatrixCell is the traffic sent from one device to another, by index into
+// DeviceMatrix.Devices
+type MatrixCell struct {
+	Source int   `json:"source"`
+	Target int   `json:"target"`
+	Bytes  int64 `json:"bytes"`
+	// Fraction is Bytes over the source's total, set when normalized
+	Fraction float64 `json:"fraction,omitempty"`
+}
+
+// DeviceMatrix is a sparse adjacency matrix of bytes between devices
+type DeviceMatrix struct {
+	Devices []SankeyNode `json:"devices"`
+	Cells   []MatrixCell `json:"cells"`
+}
+
+// ErrMatrixTooLarge is returned when more devices exchanged traffic than MaxMatrixDevices
+var ErrMatrixTooLarge = fmt.Errorf("more than %d devices in device pair matrix", MaxMatrixDevices)
+
+// BuildDevicePairMatrix sums bytes for each ordered pair of devices. Flows with
+// an endpoint that no device owns, or between a device and itself, are skipped.
+// With normalize, each cell also carries its share of the source's total.
+func BuildDevicePairMatrix(devices []Device, flows []RawFlowEntry, normalize bool) (DeviceMatrix, error) {
+	owners := devicesByAddress(devices)
+
+	type pair struct{ source, target string }
+	weights := make(map[pair]int64)
+	involved := make(map[string]Device)
+	for _, flow := range flows {
+		src, srcOK := owners[flow.SourceIP]
+		dst, dstOK := owners[flow.DestinationIP]
+		if !srcOK || !dstOK || src.ID == dst.ID {
+			continue
+		}
+		weights[pair{src.ID, dst.ID}] += flow.TotalBytes
+		involved[src.ID] = src
+		involved[dst.ID] = dst
+	}
+
+	if len(involved) > MaxMatrixDevices {
+		return DeviceMatrix{}, ErrMatrixTooLarge
+	}
+
+	matrix := DeviceMatrix{Devices: []SankeyNode{}, Cells: []MatrixCell{}}
+	for id, device := range involved {
+		matrix.Devices = append(matrix.Devices, SankeyNode{ID: id, Label: device.Name})
+	}
+	sort.Slice(matrix.Devices, func(i, j int) bool {
+		return matrix.Devices[i].ID < matrix.Devices[j].ID
+	})
+	index := make(map[string]int, len(matrix.Devices))
+	for i, node := range matrix.Devices {
+		index[node.ID] = i
+	}
+
+	sourceTotals := make(map[string]int64)
+	for p, bytes := range weights {
+		sourceTotals[p.source] += bytes
+	}
+
+	for p, bytes := range weights {
+		cell := MatrixCell{Source: index[p.source], Target: index[p.target], Bytes: bytes}
+		if normalize && sourceTotals[p.source] > 0 {
+			cell.Fraction = float64(bytes) / float64(sourceTotals[p.source])
+		}
+		matrix.Cells = append(matrix.Cells, cell)
+	}
+	sort.Slice(matrix.Cells, func(i, j int) bool {
+		if matrix.Cells[i].Source != matrix.Cells[j].Source {
+			return matrix.Cells[i].Source < matrix.Cells[j].Source
+		}
+		return matrix.Cells[i].Target < matrix.Cells[j].Target
+	})
+
+	return matrix, nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBuildDevicePairMatrix(t *testing.T) {
+	devices := []Device{
+		{ID: "a", Name: "alpha", Addresses: []string{"100.64.0.1"}},
+		{ID: "b", Name: "bravo", Addresses: []string{"100.64.0.2"}},
+	}
+	flows := []RawFlowEntry{
+		{SourceIP: "100.64.0.1", DestinationIP: "100.64.0.2", TotalBytes: 300},
+		{SourceIP: "100.64.0.1", DestinationIP: "100.64.0.2", TotalBytes: 100},
+		{SourceIP: "100.64.0.2", DestinationIP: "100.64.0.1", TotalBytes: 50},
+		{SourceIP: "100.64.0.1", DestinationIP: "100.64.0.1", TotalBytes: 999},
+		{SourceIP: "100.64.0.1", DestinationIP: "192.0.2.1", TotalBytes: 999},
+	}
+
+	matrix, err := BuildDevicePairMatrix(devices, flows, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matrix.Devices) != 2 || matrix.Devices[0].ID != "a" || matrix.Devices[1].ID != "b" {
+		t.Fatalf("devices = %+v, want a then b", matrix.Devices)
+	}
+	want := []MatrixCell{
+		{Source: 0, Target: 1, Bytes: 400, Fraction: 1},
+		{Source: 1, Target: 0, Bytes: 50, Fraction: 1},
+	}
+	if len(matrix.Cells) != len(want) {
+		t.Fatalf("cells = %+v, want %+v", matrix.Cells, want)
+	}
+	for i := range want {
+		if matrix.Cells[i] != want[i] {
+			t.Errorf("cell %d = %+v, want %+v", i, matrix.Cells[i], want[i])
+		}
+	}
+}
+
+func TestBuildDevicePairMatrixTooLarge(t *testing.T) {
+	var devices []Device
+	var flows []RawFlowEntry
+	for i := 0; i <= MaxMatrixDevices; i++ {
+		addr := fmt.Sprintf("100.64.%d.%d", i/256, i%256)
+		devices = append(devices, Device{ID: fmt.Sprint(i), Addresses: []string{addr}})
+		if i > 0 {
+			flows = append(flows, RawFlowEntry{SourceIP: "100.64.0.0", DestinationIP: addr, TotalBytes: 1})
+		}
+	}
+
+	if _, err := BuildDevicePairMatrix(devices, flows, false); !errors.Is(err, ErrMatrixTooLarge) {
+		t.Errorf("err = %v, want ErrMatrixTooLarge", err)
+	}
+}
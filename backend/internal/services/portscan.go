@@ -0,0 +1,104 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultPortScanThreshold is the number of distinct destination ports one
+// source must touch on one target before it is reported as a scan
+const DefaultPortScanThreshold = 20
+
+// ScanEvent is a source that contacted many distinct ports on a single target
+type ScanEvent struct {
+	ScannerIP     string    `json:"scannerIP"`
+	ScannerDevice string    `json:"scannerDevice,omitempty"`
+	TargetIP      string    `json:"targetIP"`
+	TargetDevice  string    `json:"targetDevice,omitempty"`
+	Ports         []string  `json:"ports"`
+	PortCount     int       `json:"portCount"`
+	FlowCount     int       `json:"flowCount"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+}
+
+type scanPair struct {
+	src, dst string
+}
+
+// DetectPortScans reports each source/target pair where the source reached
+// at least threshold distinct destination ports on the target. Only
+// destination ports count, so a client's changing ephemeral source ports
+// never look like a scan. This is a heuristic: busy legitimate clients (e.g.
+// service discovery or monitoring) can cross the threshold too. Results are
+// sorted by port count, highest first.
+func DetectPortScans(devices []Device, flows []RawFlowEntry, threshold int) []ScanEvent {
+	owners := devicesByAddress(devices)
+
+	pairs := make(map[scanPair]*ScanEvent)
+	ports := make(map[scanPair]map[string]bool)
+	for _, flow := range flows {
+		if flow.DestinationPort == "" {
+			continue
+		}
+		key := scanPair{flow.SourceIP, flow.DestinationIP}
+		event, ok := pairs[key]
+		if !ok {
+			event = &ScanEvent{
+				ScannerIP:     flow.SourceIP,
+				ScannerDevice: owners[flow.SourceIP].Name,
+				TargetIP:      flow.DestinationIP,
+				TargetDevice:  owners[flow.DestinationIP].Name,
+				FirstSeen:     flow.StartTime,
+				LastSeen:      flow.EndTime,
+			}
+			pairs[key] = event
+			ports[key] = make(map[string]bool)
+		}
+		event.FlowCount++
+		if flow.StartTime.Before(event.FirstSeen) {
+			event.FirstSeen = flow.StartTime
+		}
+		if flow.EndTime.After(event.LastSeen) {
+			event.LastSeen = flow.EndTime
+		}
+		ports[key][flow.DestinationPort] = true
+	}
+
+	events := []ScanEvent{}
+	for key, event := range pairs {
+		if len(ports[key]) < threshold {
+			continue
+		}
+		for port := range ports[key] {
+			event.Ports = append(event.Ports, port)
+		}
+		sortPorts(event.Ports)
+		event.PortCount = len(event.Ports)
+		events = append(events, *event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].PortCount != events[j].PortCount {
+			return events[i].PortCount > events[j].PortCount
+		}
+		if events[i].ScannerIP != events[j].ScannerIP {
+			return events[i].ScannerIP < events[j].ScannerIP
+		}
+		return events[i].TargetIP < events[j].TargetIP
+	})
+	return events
+}
+
+// sortPorts orders port strings numerically
+func sortPorts(ports []string) {
+	sort.Slice(ports, func(i, j int) bool {
+		a, errA := strconv.Atoi(ports[i])
+		b, errB := strconv.Atoi(ports[j])
+		if errA != nil || errB != nil {
+			return ports[i] < ports[j]
+		}
+		return a < b
+	})
+}
@@ -0,0 +1,95 @@
+package services
+
+import "sort"
+
+// Names of the nodes that collect links beyond the top N
+const (
+	sankeyOtherSources      = "other-sources"
+	sankeyOtherDestinations = "other-destinations"
+)
+
+// SankeyNode is a device, or an IP that no device owns
+type SankeyNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// SankeyLink is the total bytes sent from one node to another
+type SankeyLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// SankeyGraph is a node/link graph of byte flows for a Sankey diagram
+type SankeyGraph struct {
+	Nodes []SankeyNode `json:"nodes"`
+	Links []SankeyLink `json:"links"`
+}
+
+// BuildSankey sums bytes per source/destination pair, resolving addresses to
+// devices where possible. Only the topN heaviest links are kept; the rest are
+// merged into a single link between two "other" nodes. Traffic a device sends
+// to itself is dropped. Links are directed, so A->B and B->A stay separate.
+func BuildSankey(devices []Device, flows []RawFlowEntry, topN int) SankeyGraph {
+	owners := devicesByAddress(devices)
+	nodes := make(map[string]SankeyNode)
+	nodeFor := func(ip string) string {
+		node := SankeyNode{ID: ip, Label: ip}
+		if device, ok := owners[ip]; ok {
+			node = SankeyNode{ID: device.ID, Label: device.Name}
+		}
+		nodes[node.ID] = node
+		return node.ID
+	}
+
+	type pair struct{ source, target string }
+	weights := make(map[pair]int64)
+	for _, flow := range flows {
+		p := pair{nodeFor(flow.SourceIP), nodeFor(flow.DestinationIP)}
+		if p.source == p.target {
+			continue
+		}
+		weights[p] += flow.TotalBytes
+	}
+
+	links := make([]SankeyLink, 0, len(weights))
+	for p, bytes := range weights {
+		links = append(links, SankeyLink{Source: p.source, Target: p.target, Bytes: bytes})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Bytes != links[j].Bytes {
+			return links[i].Bytes > links[j].Bytes
+		}
+		if links[i].Source != links[j].Source {
+			return links[i].Source < links[j].Source
+		}
+		return links[i].Target < links[j].Target
+	})
+
+	if topN > 0 && len(links) > topN {
+		other := SankeyLink{Source: sankeyOtherSources, Target: sankeyOtherDestinations}
+		for _, link := range links[topN:] {
+			other.Bytes += link.Bytes
+		}
+		links = append(links[:topN], other)
+		nodes[sankeyOtherSources] = SankeyNode{ID: sankeyOtherSources, Label: "Other sources"}
+		nodes[sankeyOtherDestinations] = SankeyNode{ID: sankeyOtherDestinations, Label: "Other destinations"}
+	}
+
+	// Only keep nodes that a remaining link touches
+	used := make(map[string]bool)
+	for _, link := range links {
+		used[link.Source] = true
+		used[link.Target] = true
+	}
+	graph := SankeyGraph{Nodes: []SankeyNode{}, Links: links}
+	for id := range used {
+		graph.Nodes = append(graph.Nodes, nodes[id])
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+
+	return graph
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"sort"
+	"strings"
+)
+
+// DeviceMatch is a device found by FilterDevices along with why it matched
+type DeviceMatch struct {
+	Device
+	// MatchReason names the field and match kind, e.g. "hostname prefix" or "tag substring"
+	MatchReason string `json:"matchReason"`
+
+	prefix bool
+}
+
+// FilterDevices returns the devices whose name, hostname, user, addresses or
+// tags contain q, compared case-insensitively. Prefix matches sort ahead of
+// substring matches; ties keep the input order. An empty query matches nothing.
+func FilterDevices(devices []Device, q string) []DeviceMatch {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" {
+		return []DeviceMatch{}
+	}
+
+	matches := []DeviceMatch{}
+	for _, device := range devices {
+		if match, ok := matchDevice(device, q); ok {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].prefix && !matches[j].prefix
+	})
+
+	return matches
+}
+
+// matchDevice checks the searchable fields in order and reports the best match,
+// preferring a prefix match on any field over a substring match
+func matchDevice(device Device, q string) (DeviceMatch, bool) {
+	fields := []struct {
+		name   string
+		values []string
+	}{
+		{"name", []string{device.Name}},
+		{"hostname", []string{device.Hostname}},
+		{"user", []string{device.User}},
+		{"address", device.Addresses},
+		{"tag", device.Tags},
+	}
+
+	substringField := ""
+	for _, field := range fields {
+		for _, value := range field.values {
+			value = strings.ToLower(value)
+			if strings.HasPrefix(value, q) {
+				return DeviceMatch{Device: device, MatchReason: field.name + " prefix", prefix: true}, true
+			}
+			if substringField == "" && strings.Contains(value, q) {
+				substringField = field.name
+			}
+		}
+	}
+
+	if substringField == "" {
+		return DeviceMatch{}, false
+	}
+	return DeviceMatch{Device: device, MatchReason: substringField + " substring"}, true
+}
+
+// SearchRawFlows returns the flows where q appears, case-insensitively, in the
+// source or destination IP, port, owning device's name or hostname, the
+// protocol name or the destination VIP service. An empty query matches nothing.
+func SearchRawFlows(devices []Device, flows []RawFlowEntry, q string) []RawFlowEntry {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" {
+		return []RawFlowEntry{}
+	}
+
+	owners := devicesByAddress(devices)
+	contains := func(value string) bool {
+		return value != "" && strings.Contains(strings.ToLower(value), q)
+	}
+	deviceMatches := func(ip string) bool {
+		device, ok := owners[ip]
+		return ok && (contains(device.Name) || contains(device.Hostname))
+	}
+
+	matches := []RawFlowEntry{}
+	for _, flow := range flows {
+		if contains(flow.SourceIP) || contains(flow.DestinationIP) ||
+			contains(flow.SourcePort) || contains(flow.DestinationPort) ||
+			contains(flow.Protocol) || contains(flow.DestinationService) ||
+			deviceMatches(flow.SourceIP) || deviceMatches(flow.DestinationIP) {
+			matches = append(matches, flow)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,49 @@
+package services
+
+import "sort"
+
+// DefaultMaxAvgPacketBytes is the average packet size at or below which a flow
+// is reported by DetectSmallPacketFlows. Bare TCP ACKs are 40-60 bytes, so a
+// flow averaging under 100 bytes carries little payload per packet.
+const DefaultMaxAvgPacketBytes = 100
+
+// MinSmallPacketCount is the fewest packets a flow needs before its average
+// packet size is judged; short handshakes are always small
+const MinSmallPacketCount = 10
+
+// SmallPacketFlow is a flow whose average packet size is unusually small
+type SmallPacketFlow struct {
+	RawFlowEntry
+	// AvgPacketBytes is TotalBytes divided by TotalPackets
+	AvgPacketBytes float64 `json:"avgPacketBytes"`
+}
+
+// DetectSmallPacketFlows flags flows whose average packet size is at most
+// maxAvgPacketBytes, which can point at retransmits or tiny-packet floods.
+// Flows with fewer than MinSmallPacketCount packets, or with no byte count,
+// are skipped. Like DetectByteOutliers this is a heuristic: chatty protocols
+// such as DNS or interactive SSH are legitimately small. Results are sorted
+// worst-first: smallest average, then most packets.
+func DetectSmallPacketFlows(flows []RawFlowEntry, maxAvgPacketBytes float64) []SmallPacketFlow {
+	small := []SmallPacketFlow{}
+	for _, flow := range flows {
+		if flow.TotalPackets < MinSmallPacketCount || flow.TotalBytes <= 0 {
+			continue
+		}
+		avg := float64(flow.TotalBytes) / float64(flow.TotalPackets)
+		if avg <= maxAvgPacketBytes {
+			small = append(small, SmallPacketFlow{RawFlowEntry: flow, AvgPacketBytes: avg})
+		}
+	}
+
+	sort.Slice(small, func(i, j int) bool {
+		if small[i].AvgPacketBytes != small[j].AvgPacketBytes {
+			return small[i].AvgPacketBytes < small[j].AvgPacketBytes
+		}
+		if small[i].TotalPackets != small[j].TotalPackets {
+			return small[i].TotalPackets > small[j].TotalPackets
+		}
+		return small[i].ID < small[j].ID
+	})
+	return small
+}
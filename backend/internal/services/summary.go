@@ -0,0 +1,336 @@
+package services
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// ProtocolSummary aggregates traffic for one protocol
+type ProtocolSummary struct {
+	Protocol                 string `json:"protocol"`
+	TotalBytes               int64  `json:"totalBytes"`
+	TotalPackets             int64  `json:"totalPackets"`
+	FlowCount                int    `json:"flowCount"`
+	DistinctDestinationPorts int    `json:"distinctDestinationPorts"`
+}
+
+// otherProtocol buckets every protocol without a known name (proto-N)
+const otherProtocol = "other"
+
+// SummarizeByProtocol totals bytes, packets, flows and distinct destination ports
+// per protocol, sorted by bytes descending. Unnamed protocols share one bucket.
+func SummarizeByProtocol(flows []RawFlowEntry) []ProtocolSummary {
+	summaries := make(map[string]*ProtocolSummary)
+	ports := make(map[string]map[string]struct{})
+
+	for _, flow := range flows {
+		protocol := flow.Protocol
+		if strings.HasPrefix(protocol, "proto-") {
+			protocol = otherProtocol
+		}
+
+		summary, ok := summaries[protocol]
+		if !ok {
+			summary = &ProtocolSummary{Protocol: protocol}
+			summaries[protocol] = summary
+			ports[protocol] = make(map[string]struct{})
+		}
+		summary.TotalBytes += flow.TotalBytes
+		summary.TotalPackets += flow.TotalPackets
+		summary.FlowCount++
+		if flow.DestinationPort != "" {
+			ports[protocol][flow.DestinationPort] = struct{}{}
+		}
+	}
+
+	result := make([]ProtocolSummary, 0, len(summaries))
+	for protocol, summary := range summaries {
+		summary.DistinctDestinationPorts = len(ports[protocol])
+		result = append(result, *summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalBytes != result[j].TotalBytes {
+			return result[i].TotalBytes > result[j].TotalBytes
+		}
+		return result[i].Protocol < result[j].Protocol
+	})
+
+	return result
+}
+
+// PortSummary aggregates traffic to one destination port across all hosts
+type PortSummary struct {
+	Port         string `json:"port"`
+	TotalBytes   int64  `json:"totalBytes"`
+	TotalPackets int64  `json:"totalPackets"`
+	FlowCount    int    `json:"flowCount"`
+	// DistinctPeers counts the source addresses that sent traffic to the port
+	DistinctPeers int `json:"distinctPeers"`
+}
+
+// noPort buckets flows without a destination port, such as ICMP
+const noPort = "none"
+
+// SummarizeByPort totals bytes, packets, flows and distinct source addresses
+// per destination port, sorted by bytes descending
+func SummarizeByPort(flows []RawFlowEntry) []PortSummary {
+	summaries := make(map[string]*PortSummary)
+	peers := make(map[string]map[string]struct{})
+
+	for _, flow := range flows {
+		port := flow.DestinationPort
+		if port == "" {
+			port = noPort
+		}
+
+		summary, ok := summaries[port]
+		if !ok {
+			summary = &PortSummary{Port: port}
+			summaries[port] = summary
+			peers[port] = make(map[string]struct{})
+		}
+		summary.TotalBytes += flow.TotalBytes
+		summary.TotalPackets += flow.TotalPackets
+		summary.FlowCount++
+		peers[port][flow.SourceIP] = struct{}{}
+	}
+
+	result := make([]PortSummary, 0, len(summaries))
+	for port, summary := range summaries {
+		summary.DistinctPeers = len(peers[port])
+		result = append(result, *summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalBytes != result[j].TotalBytes {
+			return result[i].TotalBytes > result[j].TotalBytes
+		}
+		return result[i].Port < result[j].Port
+	})
+
+	return result
+}
+
+// SubnetSummary aggregates traffic to one destination subnet
+type SubnetSummary struct {
+	Subnet       string `json:"subnet"`
+	TotalBytes   int64  `json:"totalBytes"`
+	TotalPackets int64  `json:"totalPackets"`
+	FlowCount    int    `json:"flowCount"`
+}
+
+// SummarizeBySubnet totals bytes, packets and flows per destination subnet,
+// masking IPv4 destinations to v4Prefix bits and IPv6 ones to v6Prefix bits.
+// Flows whose destination is not an IP address are skipped. Sorted by bytes
+// descending.
+func SummarizeBySubnet(flows []RawFlowEntry, v4Prefix, v6Prefix int) []SubnetSummary {
+	summaries := make(map[netip.Prefix]*SubnetSummary)
+
+	for _, flow := range flows {
+		addr, err := netip.ParseAddr(flow.DestinationIP)
+		if err != nil {
+			continue
+		}
+		addr = addr.Unmap().WithZone("")
+		bits := v6Prefix
+		if addr.Is4() {
+			bits = v4Prefix
+		}
+		subnet, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+
+		summary, ok := summaries[subnet]
+		if !ok {
+			summary = &SubnetSummary{Subnet: subnet.String()}
+			summaries[subnet] = summary
+		}
+		summary.TotalBytes += flow.TotalBytes
+		summary.TotalPackets += flow.TotalPackets
+		summary.FlowCount++
+	}
+
+	result := make([]SubnetSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalBytes != result[j].TotalBytes {
+			return result[i].TotalBytes > result[j].TotalBytes
+		}
+		return result[i].Subnet < result[j].Subnet
+	})
+
+	return result
+}
+
+// TalkerSummary totals the traffic sent from one source address
+type TalkerSummary struct {
+	IP         string `json:"ip"`
+	DeviceName string `json:"deviceName,omitempty"`
+	TotalBytes int64  `json:"totalBytes"`
+	FlowCount  int    `json:"flowCount"`
+}
+
+// TopTalkers returns the limit source addresses with the most bytes, naming
+// the tailnet device that owns each address when there is one
+func TopTalkers(devices []Device, flows []RawFlowEntry, limit int) []TalkerSummary {
+	owners := devicesByAddress(devices)
+
+	talkers := make(map[string]*TalkerSummary)
+	for _, flow := range flows {
+		talker, ok := talkers[flow.SourceIP]
+		if !ok {
+			talker = &TalkerSummary{IP: flow.SourceIP, DeviceName: owners[flow.SourceIP].Name}
+			talkers[flow.SourceIP] = talker
+		}
+		talker.TotalBytes += flow.TotalBytes
+		talker.FlowCount++
+	}
+
+	result := make([]TalkerSummary, 0, len(talkers))
+	for _, talker := range talkers {
+		result = append(result, *talker)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalBytes != result[j].TotalBytes {
+			return result[i].TotalBytes > result[j].TotalBytes
+		}
+		return result[i].IP < result[j].IP
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// unknownValue labels devices that report no OS or client version
+const unknownValue = "unknown"
+
+// DeviceStats counts devices for fleet reporting
+type DeviceStats struct {
+	Total           int            `json:"total"`
+	Online          int            `json:"online"`
+	Offline         int            `json:"offline"`
+	Authorized      int            `json:"authorized"`
+	Unauthorized    int            `json:"unauthorized"`
+	UpdateAvailable int            `json:"updateAvailable"`
+	ByOS            map[string]int `json:"byOS"`
+	ByClientVersion map[string]int `json:"byClientVersion"`
+}
+
+// SummarizeDevices counts devices by OS and client version, online vs offline,
+// authorized vs not, and how many have a client update available
+func SummarizeDevices(devices []Device) DeviceStats {
+	stats := DeviceStats{
+		Total:           len(devices),
+		ByOS:            make(map[string]int),
+		ByClientVersion: make(map[string]int),
+	}
+
+	for _, device := range devices {
+		if device.Online {
+			stats.Online++
+		} else {
+			stats.Offline++
+		}
+		if device.Authorized {
+			stats.Authorized++
+		} else {
+			stats.Unauthorized++
+		}
+		if device.UpdateAvailable {
+			stats.UpdateAvailable++
+		}
+
+		osName := device.OS
+		if osName == "" {
+			osName = unknownValue
+		}
+		stats.ByOS[osName]++
+
+		version := device.ClientVersion
+		if version == "" {
+			version = unknownValue
+		}
+		stats.ByClientVersion[version]++
+	}
+
+	return stats
+}
+
+// TalkerStat totals one device's traffic, or one address's when no device
+// owns it, counting both the flows it sent and the flows it received
+type TalkerStat struct {
+	// ID is the device ID, or the IP for an address no device owns
+	ID           string `json:"id"`
+	DeviceName   string `json:"deviceName,omitempty"`
+	IP           string `json:"ip,omitempty"`
+	TxBytes      int64  `json:"txBytes"`
+	RxBytes      int64  `json:"rxBytes"`
+	TotalBytes   int64  `json:"totalBytes"`
+	TxPackets    int64  `json:"txPackets"`
+	RxPackets    int64  `json:"rxPackets"`
+	TotalPackets int64  `json:"totalPackets"`
+	FlowCount    int    `json:"flowCount"`
+}
+
+// ComputeTopTalkers returns the n devices, or unowned addresses, with the
+// most bytes sent and received, busiest first. A flow's tx counters are sent
+// by its source and received by its destination; rx counters the reverse. A
+// device at both ends of a flow counts it once. n <= 0 returns every talker.
+func ComputeTopTalkers(devices []Device, flows []RawFlowEntry, n int) []TalkerStat {
+	owners := devicesByAddress(devices)
+	talkers := make(map[string]*TalkerStat)
+	talker := func(ip string) *TalkerStat {
+		key, name, addr := ip, "", ip
+		if device, ok := owners[ip]; ok {
+			key, name, addr = device.ID, device.Name, ""
+		}
+		stat, ok := talkers[key]
+		if !ok {
+			stat = &TalkerStat{ID: key, DeviceName: name, IP: addr}
+			talkers[key] = stat
+		}
+		return stat
+	}
+
+	for _, flow := range flows {
+		src, dst := talker(flow.SourceIP), talker(flow.DestinationIP)
+		src.TxBytes += flow.TxBytes
+		src.RxBytes += flow.RxBytes
+		src.TxPackets += flow.TxPackets
+		src.RxPackets += flow.RxPackets
+		dst.TxBytes += flow.RxBytes
+		dst.RxBytes += flow.TxBytes
+		dst.TxPackets += flow.RxPackets
+		dst.RxPackets += flow.TxPackets
+		src.FlowCount++
+		if dst != src {
+			dst.FlowCount++
+		}
+	}
+
+	result := make([]TalkerStat, 0, len(talkers))
+	for _, stat := range talkers {
+		stat.TotalBytes = stat.TxBytes + stat.RxBytes
+		stat.TotalPackets = stat.TxPackets + stat.RxPackets
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalBytes != result[j].TotalBytes {
+			return result[i].TotalBytes > result[j].TotalBytes
+		}
+		return result[i].ID < result[j].ID
+	})
+
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+package services
+
+import "testing"
+
+func TestComputeTopTalkers(t *testing.T) {
+	devices := []Device{
+		{ID: "web", Name: "web", Addresses: []string{"100.64.0.1", "fd7a:115c:a1e0::1"}},
+		{ID: "db", Name: "db", Addresses: []string{"100.64.0.2"}},
+	}
+	flows := []RawFlowEntry{
+		{SourceIP: "100.64.0.1", DestinationIP: "100.64.0.2", TxBytes: 100, RxBytes: 1000, TxPackets: 1, RxPackets: 10},
+		{SourceIP: "fd7a:115c:a1e0::1", DestinationIP: "8.8.8.8", TxBytes: 50, RxBytes: 5, TxPackets: 2, RxPackets: 1},
+		{SourceIP: "10.0.0.9", DestinationIP: "100.64.0.2", TxBytes: 7, TxPackets: 1},
+	}
+
+	got := ComputeTopTalkers(devices, flows, 0)
+	want := []TalkerStat{
+		{ID: "web", DeviceName: "web", TxBytes: 150, RxBytes: 1005, TotalBytes: 1155, TxPackets: 3, RxPackets: 11, TotalPackets: 14, FlowCount: 2},
+		{ID: "db", DeviceName: "db", TxBytes: 1000, RxBytes: 107, TotalBytes: 1107, TxPackets: 10, RxPackets: 2, TotalPackets: 12, FlowCount: 2},
+		{ID: "8.8.8.8", IP: "8.8.8.8", TxBytes: 5, RxBytes: 50, TotalBytes: 55, TxPackets: 1, RxPackets: 2, TotalPackets: 3, FlowCount: 1},
+		{ID: "10.0.0.9", IP: "10.0.0.9", TxBytes: 7, TotalBytes: 7, TxPackets: 1, TotalPackets: 1, FlowCount: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d talkers, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("talker %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if top := ComputeTopTalkers(devices, flows, 1); len(top) != 1 || top[0].ID != "web" {
+		t.Errorf("top 1 = %+v, want web", top)
+	}
+}
@@ -1,18 +1,25 @@
 package services
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/rajsinghtech/tsflow/backend/internal/config"
+	"github.com/rajsinghtech/tsflow/backend/internal/metrics"
 	"github.com/rajsinghtech/tsflow/backend/internal/utils"
+	"golang.org/x/oauth2"
 	tailscale "tailscale.com/client/tailscale/v2"
 )
 
@@ -22,11 +29,24 @@ type TailscaleService struct {
 	baseURL  string
 	client   *http.Client
 	useOAuth bool
-	tsClient *tailscale.Client
+	geoIP    *GeoIPResolver
+
+	// onlineThreshold is how recently a device must have been seen to count
+	// as online when the API does not say
+	onlineThreshold time.Duration
+
+	// upstreamTimeout bounds each API request except network log downloads,
+	// which are bounded by their callers' contexts
+	upstreamTimeout time.Duration
+
+	// randMu guards rng, which picks retry jitter for concurrent chunk fetches
+	randMu sync.Mutex
+	rng    *rand.Rand
 }
 
 type Device struct {
 	ID                     string   `json:"id"`
+	NodeID                 string   `json:"nodeId"`
 	Name                   string   `json:"name"`
 	Hostname               string   `json:"hostname"`
 	User                   string   `json:"user"`
@@ -64,12 +84,64 @@ type NetworkLogsResponse struct {
 	Logs []NetworkLogEntry `json:"logs"`
 }
 
+// newUpstreamTransport returns the default transport with connection pool
+// limits from config, sized for concurrent requests to the single API host
+func newUpstreamTransport(cfg *config.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.UpstreamMaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.UpstreamMaxIdleConns
+	transport.MaxConnsPerHost = cfg.UpstreamMaxConns
+	transport.IdleConnTimeout = cfg.UpstreamIdleConnTimeout
+	return transport
+}
+
+// breakerTransport fails requests fast while the circuit breaker is open and
+// reports each response to it. Transport errors and 5xx responses are
+// failures; any other response shows the API is up.
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *utils.CircuitBreaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.Allow(); err != nil {
+		metrics.RecordCircuitRejection()
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		t.breaker.Abandon()
+	case err != nil:
+		t.breaker.Record(false)
+	default:
+		t.breaker.Record(resp.StatusCode < 500)
+	}
+	return resp, err
+}
+
 func NewTailscaleService(cfg *config.Config) *TailscaleService {
 	ts := &TailscaleService{
 		tailnet: cfg.TailscaleTailnet,
 		baseURL: cfg.TailscaleAPIURL,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+
+		onlineThreshold: cfg.OnlineThreshold,
+		upstreamTimeout: cfg.UpstreamTimeout,
+	}
+
+	breaker := utils.NewCircuitBreaker(cfg.CircuitThreshold, cfg.CircuitCooldown)
+	breaker.OnStateChange = func(state utils.CircuitState) {
+		log.Printf("WARNING Tailscale API circuit breaker %s", state)
+		metrics.SetCircuitState(int(state))
 	}
 
+	// One pooled transport serves every upstream request, so parallel chunk
+	// fetches reuse connections instead of dialing new ones, and one breaker
+	// sees every failure
+	transport := &breakerTransport{base: newUpstreamTransport(cfg), breaker: breaker}
+
 	if cfg.TailscaleOAuthClientID != "" && cfg.TailscaleOAuthClientSecret != "" {
 		// Use the Tailscale client's built-in OAuth support
 		oauthConfig := tailscale.OAuthConfig{
@@ -77,32 +149,55 @@ func NewTailscaleService(cfg *config.Config) *TailscaleService {
 			ClientSecret: cfg.TailscaleOAuthClientSecret,
 			Scopes:       cfg.TailscaleOAuthScopes,
 		}
-		
-		ts.tsClient = &tailscale.Client{
-			HTTP:     oauthConfig.HTTPClient(),
-			Tailnet:  cfg.TailscaleTailnet,
+
+		tsHTTP := oauthConfig.HTTPClient()
+		if oauthTransport, ok := tsHTTP.Transport.(*oauth2.Transport); ok {
+			oauthTransport.Base = transport
 		}
-		ts.client = oauthConfig.HTTPClient()
+		ts.client = &http.Client{Transport: tsHTTP.Transport}
 		ts.useOAuth = true
 	} else if cfg.TailscaleAPIKey != "" {
 		ts.apiKey = cfg.TailscaleAPIKey
-		ts.client = &http.Client{
-			Timeout: 30 * time.Minute, // Much longer timeout for large requests
-		}
-		ts.tsClient = &tailscale.Client{
-			APIKey:  cfg.TailscaleAPIKey,
-			Tailnet: cfg.TailscaleTailnet,
-		}
+		ts.client = &http.Client{Transport: transport}
 		ts.useOAuth = false
 	} else {
-		ts.client = &http.Client{
-			Timeout: 30 * time.Minute, // Much longer timeout for large requests
+		ts.client = &http.Client{Transport: transport}
+	}
+
+	// No http.Client.Timeout: a multi-day log download can run far past
+	// UpstreamTimeout, so requests are bounded by their contexts instead
+	ts.client.Transport = metrics.InstrumentTransport(ts.client.Transport)
+
+	if cfg.GeoIPDatabase != "" {
+		geoIP, err := NewGeoIPResolver(cfg.GeoIPDatabase)
+		if err != nil {
+			log.Printf("WARNING GeoIP enrichment disabled: %v", err)
+		} else {
+			ts.geoIP = geoIP
 		}
 	}
 
 	return ts
 }
 
+// SetRandSource replaces the source used for retry jitter, e.g. with a seeded one in tests
+func (ts *TailscaleService) SetRandSource(src rand.Source) {
+	ts.randMu.Lock()
+	defer ts.randMu.Unlock()
+	ts.rng = rand.New(src)
+}
+
+// jitter returns a random duration in [0, ceiling] ("full jitter"), so concurrent
+// retries spread out instead of hitting the API in lockstep
+func (ts *TailscaleService) jitter(ceiling time.Duration) time.Duration {
+	if ceiling <= 0 {
+		return 0
+	}
+	ts.randMu.Lock()
+	defer ts.randMu.Unlock()
+	return time.Duration(ts.rng.Int63n(int64(ceiling) + 1))
+}
+
 func (ts *TailscaleService) makeRequest(ctx context.Context, endpoint string) ([]byte, error) {
 	return ts.makeRequestWithRetry(ctx, endpoint, 3, 1*time.Second)
 }
@@ -110,6 +205,7 @@ func (ts *TailscaleService) makeRequest(ctx context.Context, endpoint string) ([
 func (ts *TailscaleService) makeRequestWithRetry(ctx context.Context, endpoint string, maxRetries int, initialDelay time.Duration) ([]byte, error) {
 	var lastErr error
 	delay := initialDelay
+	var wait time.Duration
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
@@ -119,35 +215,60 @@ func (ts *TailscaleService) makeRequestWithRetry(ctx context.Context, endpoint s
 			default:
 			}
 
-			timer := time.NewTimer(delay)
+			timer := time.NewTimer(wait)
 			select {
 			case <-ctx.Done():
 				timer.Stop()
 				return nil, ctx.Err()
 			case <-timer.C:
 			}
-			delay *= 2
 		}
 
-		body, err := ts.doRequest(ctx, endpoint)
+		attemptCtx, cancel := ts.attemptContext(ctx, endpoint)
+		body, err := ts.doRequest(attemptCtx, endpoint)
+		cancel()
 		if err == nil {
 			return body, nil
 		}
 
 		lastErr = err
 
+		// Don't back off and retry for a caller that has already gone away
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
 		if !ts.isRetryableError(err) {
 			return nil, err
 		}
 
+		// Prefer the server's Retry-After over our own backoff
+		wait = ts.jitter(delay)
+		var apiErr *utils.APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		delay *= 2
+
 		if attempt < maxRetries {
-			log.Printf("Request failed (attempt %d/%d), retrying in %v: %v", attempt+1, maxRetries+1, delay, err)
+			log.Printf("%sRequest failed (attempt %d/%d), retrying in %v: %v", utils.LogPrefix(ctx), attempt+1, maxRetries+1, wait, err)
+			metrics.RecordRetry(endpoint)
 		}
 	}
 
 	return nil, fmt.Errorf("request failed after %d attempts: %w", maxRetries+1, lastErr)
 }
 
+// attemptContext bounds a single request to endpoint by UpstreamTimeout.
+// Network log downloads are left to the caller's context, which allows for
+// the size of the requested range.
+func (ts *TailscaleService) attemptContext(ctx context.Context, endpoint string) (context.Context, context.CancelFunc) {
+	if ts.upstreamTimeout <= 0 || strings.Contains(endpoint, "/logging/network") {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, ts.upstreamTimeout)
+}
+
 func (ts *TailscaleService) doRequest(ctx context.Context, endpoint string) ([]byte, error) {
 	url := fmt.Sprintf("%s/api/v2%s", ts.baseURL, endpoint)
 
@@ -160,6 +281,9 @@ func (ts *TailscaleService) doRequest(ctx context.Context, endpoint string) ([]b
 		req.Header.Set("Authorization", "Bearer "+ts.apiKey)
 	}
 	req.Header.Set("Accept", "application/json")
+	// Asking explicitly turns off the transport's transparent decompression,
+	// so gzip bodies are decoded below as they stream in
+	req.Header.Set("Accept-Encoding", "gzip")
 
 	resp, err := ts.client.Do(req)
 	if err != nil {
@@ -168,11 +292,23 @@ func (ts *TailscaleService) doRequest(ctx context.Context, endpoint string) ([]b
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, utils.HTTPError(resp.StatusCode, string(body))
+		var body []byte
+		if reader, err := decodedBody(resp); err == nil {
+			body, _ = io.ReadAll(reader)
+			reader.Close()
+		}
+		apiErr := utils.HTTPError(resp.StatusCode, string(body))
+		apiErr.RetryAfter = utils.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, apiErr
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	reader, err := decodedBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	defer reader.Close()
+
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
@@ -180,69 +316,101 @@ func (ts *TailscaleService) doRequest(ctx context.Context, endpoint string) ([]b
 	return body, nil
 }
 
+// decodedBody returns the response body, gunzipping it when the server
+// compressed it. Uncompressed bodies are returned as-is.
+func decodedBody(resp *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return io.NopCloser(resp.Body), nil
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return gz, nil
+}
+
 func (ts *TailscaleService) isRetryableError(err error) bool {
 	return utils.IsRetryable(err)
 }
 
-func (ts *TailscaleService) GetDevices() (*DevicesResponse, error) {
-	if ts.tsClient != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		defer cancel()
-		
-		devices, err := ts.tsClient.Devices().List(ctx)
+// CheckConnectivity makes one cheap authenticated API call, without retries,
+// to confirm the credentials work and the API is reachable
+func (ts *TailscaleService) CheckConnectivity(ctx context.Context) error {
+	_, err := ts.doRequest(ctx, fmt.Sprintf("/tailnet/%s/devices", url.PathEscape(ts.tailnet)))
+	return err
+}
+
+// maxDevicePages bounds how many pages GetDevices follows
+const maxDevicePages = 100
+
+// GetDevices lists every device in the tailnet with all fields, including
+// routes and the API's connectivity flag, following the "next" cursor across
+// pages so large tailnets are not cut short.
+func (ts *TailscaleService) GetDevices(ctx context.Context) (*DevicesResponse, error) {
+	devicesPath := fmt.Sprintf("/tailnet/%s/devices?fields=all", url.PathEscape(ts.tailnet))
+	endpoint := devicesPath
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	// Follow a "next" cursor if the API paginates, so no devices are dropped
+	var devices []Device
+	for page := 1; ; page++ {
+		if page > maxDevicePages {
+			return nil, fmt.Errorf("devices response exceeded %d pages", maxDevicePages)
+		}
+
+		body, err := ts.makeRequest(ctx, endpoint)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get devices from tailscale client: %w", err)
+			return nil, err
 		}
-		
-		// Convert tailscale client devices to our format
-		var ourDevices []Device
-		for _, device := range devices {
-			ourDevices = append(ourDevices, Device{
-				ID:                     device.ID,
-				Name:                   device.Name,
-				Hostname:               device.Hostname,
-				User:                   device.User,
-				OS:                     device.OS,
-				Addresses:              device.Addresses,
-				Online:                 !device.LastSeen.IsZero() && time.Since(device.LastSeen.Time) < 2*time.Minute,
-				LastSeen:               device.LastSeen.Time.Format(time.RFC3339),
-				Authorized:             device.Authorized,
-				KeyExpiryDisabled:      device.KeyExpiryDisabled,
-				Created:                device.Created.Time.Format(time.RFC3339),
-				MachineKey:             device.MachineKey,
-				NodeKey:                device.NodeKey,
-				ClientVersion:          device.ClientVersion,
-				UpdateAvailable:        device.UpdateAvailable,
-				Blocksincomingnonnodes: device.BlocksIncomingConnections,
-				EnabledRoutes:          device.EnabledRoutes,
-				AdvertisedRoutes:       device.AdvertisedRoutes,
-				Tags:                   device.Tags,
-			})
+
+		var response struct {
+			Devices []apiDevice `json:"devices"`
+			Next    string      `json:"next"`
 		}
-		
-		return &DevicesResponse{Devices: ourDevices}, nil
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal devices response: %w", err)
+		}
+
+		for _, device := range response.Devices {
+			online := device.ConnectedToControl
+			if online == nil {
+				online = device.Online
+			}
+			lastSeen, _ := time.Parse(time.RFC3339, device.LastSeen)
+			device.Device.Online = ts.deviceOnline(online, lastSeen)
+			device.Device.Blocksincomingnonnodes = device.BlocksIncomingConnections
+			devices = append(devices, device.Device)
+		}
+		if response.Next == "" {
+			break
+		}
+		endpoint = devicesPath + "&cursor=" + url.QueryEscape(response.Next)
 	}
-	
-	// Fallback to old implementation
-	endpoint := fmt.Sprintf("/tailnet/%s/devices", ts.tailnet)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
+	return &DevicesResponse{Devices: devices}, nil
+}
 
-	body, err := ts.makeRequest(ctx, endpoint)
-	if err != nil {
-		return nil, err
-	}
+// apiDevice is a device as the REST API reports it, keeping its own
+// connectivity flag, when present, apart from our computed Online
+type apiDevice struct {
+	Device
+	ConnectedToControl        *bool `json:"connectedToControl"`
+	Online                    *bool `json:"online"`
+	BlocksIncomingConnections bool  `json:"blocksIncomingConnections"`
+}
 
-	var response DevicesResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal devices response: %w", err)
+// deviceOnline prefers the API's own connectivity flag and otherwise treats a
+// device seen within the online threshold as online
+func (ts *TailscaleService) deviceOnline(apiOnline *bool, lastSeen time.Time) bool {
+	if apiOnline != nil {
+		return *apiOnline
 	}
-
-	return &response, nil
+	return !lastSeen.IsZero() && time.Since(lastSeen) < ts.onlineThreshold
 }
 
-func (ts *TailscaleService) GetNetworkLogs(start, end string) (interface{}, error) {
+func (ts *TailscaleService) GetNetworkLogs(ctx context.Context, start, end string) (interface{}, error) {
 	// Parse time range to determine if we need chunking
 	startTime, err := time.Parse(time.RFC3339, start)
 	if err != nil {
@@ -255,38 +423,7 @@ func (ts *TailscaleService) GetNetworkLogs(start, end string) (interface{}, erro
 	}
 	
 	
-	// For smaller ranges, use the original approach
-	if ts.tsClient != nil {
-		// Use much longer timeout for larger time ranges
-		timeoutDuration := 10 * time.Minute
-		if endTime.Sub(startTime) > 7*24*time.Hour {
-			timeoutDuration = 30 * time.Minute // Much longer timeout for 30+ day queries
-		}
-		ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
-		defer cancel()
-		
-		var logs []tailscale.NetworkFlowLog
-		
-		err = ts.tsClient.Logging().GetNetworkFlowLogs(ctx, tailscale.NetworkFlowLogsRequest{
-			Start: startTime,
-			End:   endTime,
-		}, func(log tailscale.NetworkFlowLog) error {
-			logs = append(logs, log)
-			return nil
-		})
-		
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch network logs from tailscale client: %w", err)
-		}
-		
-		
-		return map[string]interface{}{
-			"logs": logs,
-		}, nil
-	}
-	
-	// Fallback to old implementation
-	endpoint := fmt.Sprintf("/tailnet/%s/logging/network", ts.tailnet)
+	endpoint := fmt.Sprintf("/tailnet/%s/logging/network", url.PathEscape(ts.tailnet))
 
 	if start != "" && end != "" {
 		endpoint += fmt.Sprintf("?start=%s&end=%s", url.QueryEscape(start), url.QueryEscape(end))
@@ -297,7 +434,7 @@ func (ts *TailscaleService) GetNetworkLogs(start, end string) (interface{}, erro
 	if endTime.Sub(startTime) > 7*24*time.Hour {
 		timeoutDuration = 30 * time.Minute // Much longer timeout for 30+ day queries
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
+	ctx, cancel := context.WithTimeout(ctx, timeoutDuration)
 	defer cancel()
 
 	body, err := ts.makeRequest(ctx, endpoint)
@@ -305,26 +442,43 @@ func (ts *TailscaleService) GetNetworkLogs(start, end string) (interface{}, erro
 		return nil, fmt.Errorf("failed to fetch network logs: %w", err)
 	}
 
+	logs, err := decodeNetworkLogs(body)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"logs": logs,
+	}, nil
+}
+
+// decodeNetworkLogs returns the entries of a network logs response, which is
+// either {"logs": [...]} or a bare array. Quiet ranges can come back with an
+// empty body, {}, {"logs": null} or null; all of them decode to an empty,
+// non-nil slice.
+func decodeNetworkLogs(body []byte) ([]interface{}, error) {
+	entries := []interface{}{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return entries, nil
+	}
+
 	var response interface{}
 	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal network logs response: %w", err)
 	}
 
-	// Ensure consistent response format
-	if responseMap, ok := response.(map[string]interface{}); ok {
-		if logs, exists := responseMap["logs"]; exists {
-			return map[string]interface{}{
-				"logs": logs,
-			}, nil
+	switch r := response.(type) {
+	case []interface{}:
+		entries = r
+	case map[string]interface{}:
+		if logs, ok := r["logs"].([]interface{}); ok {
+			entries = logs
 		}
 	}
-	return map[string]interface{}{
-		"logs": response,
-	}, nil
+	return entries, nil
 }
 
 // GetNetworkLogsChunked retrieves network logs in chunks for large time ranges
-func (ts *TailscaleService) GetNetworkLogsChunked(start, end string, chunkSize time.Duration) ([]interface{}, error) {
+func (ts *TailscaleService) GetNetworkLogsChunked(ctx context.Context, start, end string, chunkSize time.Duration) ([]interface{}, error) {
 	startTime, err := time.Parse(time.RFC3339, start)
 	if err != nil {
 		return nil, fmt.Errorf("invalid start time: %w", err)
@@ -337,7 +491,7 @@ func (ts *TailscaleService) GetNetworkLogsChunked(start, end string, chunkSize t
 
 	// If the time range is small enough, use the regular method
 	if endTime.Sub(startTime) <= chunkSize {
-		result, err := ts.GetNetworkLogs(start, end)
+		result, err := ts.GetNetworkLogs(ctx, start, end)
 		if err != nil {
 			return nil, err
 		}
@@ -355,7 +509,7 @@ func (ts *TailscaleService) GetNetworkLogsChunked(start, end string, chunkSize t
 		}
 
 		// Fetch logs for this chunk
-		logs, err := ts.GetNetworkLogs(
+		logs, err := ts.GetNetworkLogs(ctx,
 			currentStart.Format(time.RFC3339),
 			currentEnd.Format(time.RFC3339),
 		)
@@ -376,8 +530,8 @@ func (ts *TailscaleService) GetNetworkLogsChunked(start, end string, chunkSize t
 }
 
 // GetNetworkLogsChunkedParallel retrieves network logs in parallel chunks for large time ranges
-func (ts *TailscaleService) GetNetworkLogsChunkedParallel(start, end string, chunkSize time.Duration, maxConcurrency int) ([]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+func (ts *TailscaleService) GetNetworkLogsChunkedParallel(ctx context.Context, start, end string, chunkSize time.Duration, maxConcurrency int) ([]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 	return ts.GetNetworkLogsChunkedParallelWithContext(ctx, start, end, chunkSize, maxConcurrency)
 }
@@ -394,22 +548,11 @@ func (ts *TailscaleService) GetNetworkLogsChunkedParallelWithContext(ctx context
 		return nil, fmt.Errorf("invalid end time: %w", err)
 	}
 
-	// Calculate chunks
-	var chunks []struct{ start, end time.Time }
-	currentStart := startTime
-
-	for currentStart.Before(endTime) {
-		currentEnd := currentStart.Add(chunkSize)
-		if currentEnd.After(endTime) {
-			currentEnd = endTime
-		}
-		chunks = append(chunks, struct{ start, end time.Time }{currentStart, currentEnd})
-		currentStart = currentEnd
-	}
+	chunks := splitTimeRange(startTime, endTime, chunkSize)
 
 	// If only one chunk, use regular method
 	if len(chunks) <= 1 {
-		result, err := ts.GetNetworkLogs(start, end)
+		result, err := ts.GetNetworkLogs(ctx, start, end)
 		if err != nil {
 			return nil, err
 		}
@@ -470,7 +613,7 @@ func (ts *TailscaleService) GetNetworkLogsChunkedParallelWithContext(ctx context
 				return
 			}
 
-			logs, err := ts.GetNetworkLogs(
+			logs, err := ts.GetNetworkLogs(ctx,
 				chunkStart.Format(time.RFC3339),
 				chunkEnd.Format(time.RFC3339),
 			)
@@ -501,7 +644,7 @@ func (ts *TailscaleService) GetNetworkLogsChunkedParallelWithContext(ctx context
 		}
 		
 		if res.err != nil {
-			log.Printf("Error fetching chunk %d: %v", res.index, res.err)
+			log.Printf("%sError fetching chunk %d: %v", utils.LogPrefix(ctx), res.index, res.err)
 			hasError = true
 			// Store nil for failed chunks
 			results[res.index] = nil
@@ -525,10 +668,120 @@ func (ts *TailscaleService) GetNetworkLogsChunkedParallelWithContext(ctx context
 	return allLogs, nil
 }
 
+// timeChunk is a half-open slice of a larger query time range
+type timeChunk struct {
+	start, end time.Time
+}
+
+// splitTimeRange splits [start, end) into consecutive chunks of at most chunkSize
+func splitTimeRange(start, end time.Time, chunkSize time.Duration) []timeChunk {
+	var chunks []timeChunk
+	currentStart := start
+
+	for currentStart.Before(end) {
+		currentEnd := currentStart.Add(chunkSize)
+		if currentEnd.After(end) {
+			currentEnd = end
+		}
+		chunks = append(chunks, timeChunk{currentStart, currentEnd})
+		currentStart = currentEnd
+	}
+
+	return chunks
+}
+
+// StreamNetworkLogs fetches network logs for the time range and passes each log entry
+// to emit as soon as it arrives, without buffering the full result. Ranges longer than
+// chunkSize are fetched as parallel chunks (up to maxConcurrency at once); entries keep
+// their order within a chunk. emit is never called concurrently. Cancelling ctx, e.g.
+// when the client disconnects, stops all in-flight fetches.
+func (ts *TailscaleService) StreamNetworkLogs(ctx context.Context, start, end time.Time, chunkSize time.Duration, maxConcurrency int, emit func(entry interface{}) error) error {
+	// Use much longer timeout for larger time ranges
+	timeoutDuration := 10 * time.Minute
+	if end.Sub(start) > 7*24*time.Hour {
+		timeoutDuration = 30 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeoutDuration)
+	defer cancel()
+
+	var emitMu sync.Mutex
+	serializedEmit := func(entry interface{}) error {
+		emitMu.Lock()
+		defer emitMu.Unlock()
+		return emit(entry)
+	}
+
+	chunks := splitTimeRange(start, end, chunkSize)
+	if len(chunks) <= 1 {
+		return ts.streamNetworkLogsRange(ctx, start, end, serializedEmit)
+	}
+
+	semaphore := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+
+	for _, chunk := range chunks {
+		wg.Add(1)
+		go func(chunkStart, chunkEnd time.Time) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				return
+			}
+
+			if err := ts.streamNetworkLogsRange(ctx, chunkStart, chunkEnd, serializedEmit); err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					// Stop the remaining chunks; the stream is already broken
+					cancel()
+				}
+				errMu.Unlock()
+			}
+		}(chunk.start, chunk.end)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// streamNetworkLogsRange fetches a single time range and emits each log entry in order
+func (ts *TailscaleService) streamNetworkLogsRange(ctx context.Context, start, end time.Time, emit func(entry interface{}) error) error {
+	// The endpoint returns the whole range at once
+	endpoint := fmt.Sprintf("/tailnet/%s/logging/network?start=%s&end=%s",
+		url.PathEscape(ts.tailnet),
+		url.QueryEscape(start.Format(time.RFC3339)),
+		url.QueryEscape(end.Format(time.RFC3339)))
+
+	body, err := ts.makeRequest(ctx, endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to fetch network logs: %w", err)
+	}
+
+	entries, err := decodeNetworkLogs(body)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := emit(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetNetworkMap retrieves the network map (simplified version)
-func (ts *TailscaleService) GetNetworkMap() (map[string]interface{}, error) {
+func (ts *TailscaleService) GetNetworkMap(ctx context.Context) (map[string]interface{}, error) {
 	// Get devices as the basis for network map
-	devices, err := ts.GetDevices()
+	devices, err := ts.GetDevices(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -552,33 +805,9 @@ func (ts *TailscaleService) GetNetworkMap() (map[string]interface{}, error) {
 	return networkMap, nil
 }
 
-// GetDeviceFlows retrieves flow data for a specific device
-func (ts *TailscaleService) GetDeviceFlows(deviceID string) (map[string]interface{}, error) {
-	// Note: This is a placeholder as Tailscale doesn't have a public device flows API
-	// In a real implementation, you might need to implement this differently
-	// or collect this data through other means
-
-	// For now, return mock data
-	flows := map[string]interface{}{
-		"device_id": deviceID,
-		"flows": []map[string]interface{}{
-			{
-				"source":      "unknown",
-				"destination": "unknown",
-				"protocol":    "tcp",
-				"bytes":       0,
-				"packets":     0,
-			},
-		},
-		"total_flows": 0,
-	}
-
-	return flows, nil
-}
-
 // GetDNSNameservers retrieves DNS config for the tailnet
-func (ts *TailscaleService) GetDNSNameservers() (map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (ts *TailscaleService) GetDNSNameservers(ctx context.Context) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	// Get nameservers
@@ -633,16 +862,15 @@ type StaticRecordInfo struct {
 	Comment string   `json:"comment,omitempty"`
 }
 
-// GetVIPServices fetches all VIP services (virtual IP services) for the tailnet
-func (ts *TailscaleService) GetVIPServices() (map[string]VIPServiceInfo, error) {
-	ctx := context.Background()
+// GetVIPServices fetches all VIP services (virtual IP services) for the tailnet.
+// VIP services are not available on every tailnet, so callers should degrade
+// to an empty set on error.
+func (ts *TailscaleService) GetVIPServices(ctx context.Context) (map[string]VIPServiceInfo, error) {
 	endpoint := fmt.Sprintf("/tailnet/%s/services", url.PathEscape(ts.tailnet))
 	
 	body, err := ts.makeRequest(ctx, endpoint)
 	if err != nil {
-		// VIP services might not be available for all tailnets
-		// Return empty map instead of error for graceful degradation
-		return make(map[string]VIPServiceInfo), nil
+		return nil, fmt.Errorf("failed to fetch VIP services: %w", err)
 	}
 	
 	var response struct {
@@ -662,16 +890,15 @@ func (ts *TailscaleService) GetVIPServices() (map[string]VIPServiceInfo, error)
 	return services, nil
 }
 
-// GetStaticRecords fetches all static DNS records for the tailnet
-func (ts *TailscaleService) GetStaticRecords() (map[string]StaticRecordInfo, error) {
-	ctx := context.Background()
+// GetStaticRecords fetches all static DNS records for the tailnet. Like VIP
+// services they are not available on every tailnet, so callers should degrade
+// to an empty set on error.
+func (ts *TailscaleService) GetStaticRecords(ctx context.Context) (map[string]StaticRecordInfo, error) {
 	endpoint := fmt.Sprintf("/tailnet/%s/static-records", url.PathEscape(ts.tailnet))
 	
 	body, err := ts.makeRequest(ctx, endpoint)
 	if err != nil {
-		// Static records might not be available for all tailnets
-		// Return empty map instead of error for graceful degradation
-		return make(map[string]StaticRecordInfo), nil
+		return nil, fmt.Errorf("failed to fetch static records: %w", err)
 	}
 	
 	var response struct {
@@ -682,6 +909,9 @@ func (ts *TailscaleService) GetStaticRecords() (map[string]StaticRecordInfo, err
 		return nil, fmt.Errorf("failed to parse static records: %w", err)
 	}
 	
+	if response.Records == nil {
+		response.Records = make(map[string]StaticRecordInfo)
+	}
 	return response.Records, nil
 }
 
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rajsinghtech/tsflow/backend/internal/config"
+)
+
+// newTestService returns a service using API key auth against a test server
+// running handler
+func newTestService(t *testing.T, handler http.Handler) *TailscaleService {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewTailscaleService(testConfig(srv.URL))
+}
+
+func testConfig(apiURL string) *config.Config {
+	return &config.Config{
+		TailscaleAPIKey:         "tskey-api-test",
+		TailscaleTailnet:        "example.com",
+		TailscaleAPIURL:         apiURL,
+		UpstreamTimeout:         5 * time.Second,
+		UpstreamMaxIdleConns:    4,
+		UpstreamMaxConns:        8,
+		UpstreamIdleConnTimeout: time.Minute,
+		OnlineThreshold:         2 * time.Minute,
+	}
+}
+
+func TestRetryStopsWhenContextCancelled(t *testing.T) {
+	var calls atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	ts := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// The caller navigates away while the first attempt is failing
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	start := time.Now()
+	_, err := ts.makeRequestWithRetry(ctx, "/tailnet/example.com/devices", 3, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("upstream called %d times, want 1", n)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want no backoff", elapsed)
+	}
+}
+
+func TestJitterStaysWithinBackoffCeiling(t *testing.T) {
+	ts := NewTailscaleService(testConfig("http://127.0.0.1"))
+	ts.SetRandSource(rand.NewSource(42))
+
+	var first []time.Duration
+	ceiling := time.Second
+	for attempt := 0; attempt < 8; attempt++ {
+		for i := 0; i < 100; i++ {
+			d := ts.jitter(ceiling)
+			if d < 0 || d > ceiling {
+				t.Fatalf("attempt %d: jitter(%v) = %v, want within [0, %v]", attempt, ceiling, d, ceiling)
+			}
+			if attempt == 0 && i < 5 {
+				first = append(first, d)
+			}
+		}
+		ceiling *= 2
+	}
+
+	if d := ts.jitter(0); d != 0 {
+		t.Errorf("jitter(0) = %v, want 0", d)
+	}
+
+	// The same seed gives the same delays
+	ts.SetRandSource(rand.NewSource(42))
+	for i, want := range first {
+		if got := ts.jitter(time.Second); got != want {
+			t.Errorf("reseeded jitter %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestUpstreamTimeoutSparesLogDownloads(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	cfg := testConfig("")
+	cfg.UpstreamTimeout = 50 * time.Millisecond
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(`{"logs":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+	cfg.TailscaleAPIURL = srv.URL
+	ts := NewTailscaleService(cfg)
+
+	// A log download slower than UpstreamTimeout still completes
+	if _, err := ts.makeRequestWithRetry(context.Background(), "/tailnet/example.com/logging/network?start=a&end=b", 0, time.Millisecond); err != nil {
+		t.Errorf("log download: %v, want it to outlive the upstream timeout", err)
+	}
+
+	// Any other request is cut off at UpstreamTimeout
+	start := time.Now()
+	_, err := ts.makeRequestWithRetry(context.Background(), "/tailnet/example.com/devices", 0, time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("devices: err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("devices returned after %v, want before %v", elapsed, delay)
+	}
+}
+
+func TestGetDevicesFollowsPages(t *testing.T) {
+	var queries []url.Values
+	ts := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/tailnet/example.com/devices" {
+			http.NotFound(w, r)
+			return
+		}
+		queries = append(queries, r.URL.Query())
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Write([]byte(`{"devices":[{"id":"1","name":"alpha","addresses":["100.64.0.1"],"enabledRoutes":["10.0.0.0/24"],"blocksIncomingConnections":true}],"next":"page 2"}`))
+		case "page 2":
+			w.Write([]byte(`{"devices":[{"id":"2","name":"bravo","addresses":["100.64.0.2"]}]}`))
+		default:
+			http.Error(w, "bad cursor", http.StatusBadRequest)
+		}
+	}))
+
+	resp, err := ts.GetDevices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Devices) != 2 || resp.Devices[0].ID != "1" || resp.Devices[1].ID != "2" {
+		t.Fatalf("devices = %+v, want 1 then 2", resp.Devices)
+	}
+	if routes := resp.Devices[0].EnabledRoutes; len(routes) != 1 || routes[0] != "10.0.0.0/24" {
+		t.Errorf("enabled routes = %v, want 10.0.0.0/24", routes)
+	}
+	if !resp.Devices[0].Blocksincomingnonnodes {
+		t.Error("blocksIncomingConnections was not carried over")
+	}
+	if len(queries) != 2 {
+		t.Fatalf("made %d requests, want 2", len(queries))
+	}
+	for i, q := range queries {
+		if q.Get("fields") != "all" {
+			t.Errorf("request %d: fields = %q, want all", i, q.Get("fields"))
+		}
+	}
+}
+
+func TestGetDevicesCapsPages(t *testing.T) {
+	var calls atomic.Int32
+	ts := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		fmt.Fprintf(w, `{"devices":[{"id":"%d"}],"next":"c%d"}`, n, n)
+	}))
+
+	if _, err := ts.GetDevices(context.Background()); err == nil {
+		t.Fatal("want an error from an endless cursor")
+	}
+	if n := calls.Load(); n != maxDevicePages {
+		t.Errorf("fetched %d pages, want %d", n, maxDevicePages)
+	}
+}
+
+func TestUpstreamConnectionsAreReused(t *testing.T) {
+	var newConns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":[]}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	cfg := testConfig(srv.URL)
+	cfg.UpstreamMaxConns = 2
+	ts := NewTailscaleService(cfg)
+
+	const requests = 20
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.makeRequest(context.Background(), "/tailnet/example.com/devices"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Sequential requests after the burst reuse the idle connections
+	for i := 0; i < requests; i++ {
+		if _, err := ts.makeRequest(context.Background(), "/tailnet/example.com/devices"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := newConns.Load(); n > int32(cfg.UpstreamMaxConns) {
+		t.Errorf("opened %d connections for %d requests, want at most %d", n, 2*requests, cfg.UpstreamMaxConns)
+	}
+}
+
+func TestEmptyNetworkLogsComeBackAsEmptyList(t *testing.T) {
+	bodies := map[string]string{
+		"empty body":  "",
+		"empty":       "{}",
+		"null":        "null",
+		"null logs":   `{"logs":null}`,
+		"empty logs":  `{"logs":[]}`,
+		"empty array": "[]",
+	}
+
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			ts := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v2/tailnet/example.com/logging/network" {
+					// Devices and VIP services for GetRawFlows
+					w.Write([]byte(`{}`))
+					return
+				}
+				w.Write([]byte(body))
+			}))
+
+			result, err := ts.GetNetworkLogs(context.Background(), "2025-06-01T00:00:00Z", "2025-06-01T01:00:00Z")
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(encoded) != `{"logs":[]}` {
+				t.Errorf("GetNetworkLogs = %s, want {\"logs\":[]}", encoded)
+			}
+
+			start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+			emitted := 0
+			err = ts.StreamNetworkLogs(context.Background(), start, start.Add(time.Hour), time.Hour, 1, func(interface{}) error {
+				emitted++
+				return nil
+			})
+			if err != nil || emitted != 0 {
+				t.Errorf("StreamNetworkLogs emitted %d entries, err %v; want none and no error", emitted, err)
+			}
+
+			flows, err := ts.GetRawFlows(context.Background(), start, start.Add(time.Hour))
+			if err != nil || len(flows) != 0 {
+				t.Errorf("GetRawFlows = %d flows, err %v; want none and no error", len(flows), err)
+			}
+		})
+	}
+}
+
+func TestDecodeNetworkLogsRejectsGarbage(t *testing.T) {
+	if _, err := decodeNetworkLogs([]byte("<html>bad gateway</html>")); err == nil {
+		t.Error("want an error for a non-JSON body")
+	}
+	logs, err := decodeNetworkLogs([]byte(`{"logs":[{"nodeId":"n1"}]}`))
+	if err != nil || len(logs) != 1 {
+		t.Errorf("got %d logs, err %v; want 1", len(logs), err)
+	}
+}
+
+func TestGetDevicesOnlineStatus(t *testing.T) {
+	stale := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	recent := time.Now().Add(-10 * time.Second).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		device string
+		want   bool
+	}{
+		{"stale but connected to control", `{"id":"1","lastSeen":"` + stale + `","connectedToControl":true}`, true},
+		{"recent but disconnected from control", `{"id":"1","lastSeen":"` + recent + `","connectedToControl":false}`, false},
+		{"connectedToControl wins over online", `{"id":"1","lastSeen":"` + stale + `","connectedToControl":true,"online":false}`, true},
+		{"online flag without connectedToControl", `{"id":"1","lastSeen":"` + stale + `","online":true}`, true},
+		{"no flag, recently seen", `{"id":"1","lastSeen":"` + recent + `"}`, true},
+		{"no flag, stale", `{"id":"1","lastSeen":"` + stale + `"}`, false},
+		{"no flag, never seen", `{"id":"1"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"devices":[%s]}`, tt.device)
+			}))
+
+			resp, err := ts.GetDevices(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Devices) != 1 {
+				t.Fatalf("got %d devices, want 1", len(resp.Devices))
+			}
+			if got := resp.Devices[0].Online; got != tt.want {
+				t.Errorf("online = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import "time"
+
+// TimeBucket totals the flows starting within one interval
+type TimeBucket struct {
+	Start        time.Time `json:"start"`
+	TotalBytes   int64     `json:"totalBytes"`
+	TotalPackets int64     `json:"totalPackets"`
+	FlowCount    int       `json:"flowCount"`
+}
+
+// BucketCount is how many buckets of interval BucketFlowsByInterval returns
+// for the range from start to end
+func BucketCount(start, end time.Time, interval time.Duration) int {
+	first := start.Truncate(interval)
+	if !end.After(first) {
+		return 0
+	}
+	return int((end.Sub(first) + interval - 1) / interval)
+}
+
+// BucketFlowsByInterval totals flows into consecutive buckets of interval
+// covering start to end, for throughput charts. Buckets are aligned to
+// multiples of interval (in UTC), so the first may begin before start; empty
+// buckets are included so the series has no gaps. A flow that straddles a
+// boundary counts in the bucket containing its StartTime, and flows starting
+// outside the buckets are skipped.
+func BucketFlowsByInterval(flows []RawFlowEntry, start, end time.Time, interval time.Duration) []TimeBucket {
+	first := start.Truncate(interval)
+	buckets := make([]TimeBucket, BucketCount(start, end, interval))
+	for i := range buckets {
+		buckets[i].Start = first.Add(time.Duration(i) * interval).In(start.Location())
+	}
+
+	for _, flow := range flows {
+		offset := flow.StartTime.Sub(first)
+		if offset < 0 {
+			continue
+		}
+		i := int(offset / interval)
+		if i >= len(buckets) {
+			continue
+		}
+		buckets[i].TotalBytes += flow.TotalBytes
+		buckets[i].TotalPackets += flow.TotalPackets
+		buckets[i].FlowCount++
+	}
+	return buckets
+}
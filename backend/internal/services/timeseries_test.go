@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketFlowsByInterval(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	flows := []RawFlowEntry{
+		{StartTime: at("2025-06-01T00:00:10Z"), EndTime: at("2025-06-01T00:00:20Z"), TotalBytes: 10, TotalPackets: 1},
+		// Straddles the boundary, so it counts where it started
+		{StartTime: at("2025-06-01T00:00:50Z"), EndTime: at("2025-06-01T00:01:10Z"), TotalBytes: 20, TotalPackets: 2},
+		{StartTime: at("2025-06-01T00:02:30Z"), EndTime: at("2025-06-01T00:02:40Z"), TotalBytes: 30, TotalPackets: 3},
+		// Outside the range
+		{StartTime: at("2025-05-31T23:59:00Z"), TotalBytes: 1000, TotalPackets: 100},
+		{StartTime: at("2025-06-01T00:05:00Z"), TotalBytes: 1000, TotalPackets: 100},
+	}
+
+	got := BucketFlowsByInterval(flows, at("2025-06-01T00:00:30Z"), at("2025-06-01T00:03:00Z"), time.Minute)
+	want := []TimeBucket{
+		{Start: at("2025-06-01T00:00:00Z"), TotalBytes: 30, TotalPackets: 3, FlowCount: 2},
+		{Start: at("2025-06-01T00:01:00Z")},
+		{Start: at("2025-06-01T00:02:00Z"), TotalBytes: 30, TotalPackets: 3, FlowCount: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d buckets, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || got[i].TotalBytes != want[i].TotalBytes ||
+			got[i].TotalPackets != want[i].TotalPackets || got[i].FlowCount != want[i].FlowCount {
+			t.Errorf("bucket %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBucketCount(t *testing.T) {
+	start := time.Date(2025, 6, 1, 0, 0, 30, 0, time.UTC)
+	tests := []struct {
+		end      time.Time
+		interval time.Duration
+		want     int
+	}{
+		{start.Add(30 * time.Second), time.Minute, 1},
+		{start.Add(31 * time.Second), time.Minute, 2},
+		{start.Add(time.Hour), time.Minute, 61},
+		{start, time.Minute, 1},
+		{start.Add(-time.Hour), time.Minute, 0},
+	}
+	for _, tt := range tests {
+		if got := BucketCount(start, tt.end, tt.interval); got != tt.want {
+			t.Errorf("BucketCount(%s, %s, %s) = %d, want %d", start, tt.end, tt.interval, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// UnresolvedEndpoint is a private or tailnet IP seen in flows that no device
+// in the tailnet owns
+type UnresolvedEndpoint struct {
+	IP         string    `json:"ip"`
+	TotalBytes int64     `json:"totalBytes"`
+	FlowCount  int       `json:"flowCount"`
+	Peers      int       `json:"peers"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// CollectUnresolved groups the endpoints of flows where neither side
+// resolved, that is neither the source nor the destination IP belongs to a
+// device and the destination is not a VIP service, by IP with byte and flow
+// totals and the number of distinct peers each talked to. Such traffic points
+// at hosts missing from the inventory or at misconfigured subnet routes. A
+// flow with a known device on either end is skipped. Public addresses are
+// external by definition, and multicast and link-local addresses are local
+// discovery noise, so none of those are reported. Results are sorted by
+// bytes, highest first.
+func CollectUnresolved(devices []Device, flows []RawFlowEntry) []UnresolvedEndpoint {
+	owners := devicesByAddress(devices)
+
+	endpoints := make(map[string]*UnresolvedEndpoint)
+	peers := make(map[string]map[string]bool)
+	record := func(ip, peer string, flow RawFlowEntry) {
+		if !reportableUnresolved(ip) {
+			return
+		}
+		endpoint, ok := endpoints[ip]
+		if !ok {
+			endpoint = &UnresolvedEndpoint{IP: ip, FirstSeen: flow.StartTime, LastSeen: flow.EndTime}
+			endpoints[ip] = endpoint
+			peers[ip] = make(map[string]bool)
+		}
+		endpoint.TotalBytes += flow.TotalBytes
+		endpoint.FlowCount++
+		if flow.StartTime.Before(endpoint.FirstSeen) {
+			endpoint.FirstSeen = flow.StartTime
+		}
+		if flow.EndTime.After(endpoint.LastSeen) {
+			endpoint.LastSeen = flow.EndTime
+		}
+		peers[ip][peer] = true
+	}
+
+	for _, flow := range flows {
+		if _, ok := owners[flow.SourceIP]; ok {
+			continue
+		}
+		if _, ok := owners[flow.DestinationIP]; ok || flow.DestinationService != "" {
+			continue
+		}
+		record(flow.SourceIP, flow.DestinationIP, flow)
+		record(flow.DestinationIP, flow.SourceIP, flow)
+	}
+
+	result := make([]UnresolvedEndpoint, 0, len(endpoints))
+	for ip, endpoint := range endpoints {
+		endpoint.Peers = len(peers[ip])
+		result = append(result, *endpoint)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalBytes != result[j].TotalBytes {
+			return result[i].TotalBytes > result[j].TotalBytes
+		}
+		return result[i].IP < result[j].IP
+	})
+	return result
+}
+
+// reportableUnresolved reports whether an unresolved ip is worth listing:
+// a valid address that is neither public, multicast, link-local nor
+// unspecified
+func reportableUnresolved(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || isPublicIP(addr) {
+		return false
+	}
+	addr = addr.Unmap()
+	return !addr.IsMulticast() && !addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() && !addr.IsUnspecified()
+}
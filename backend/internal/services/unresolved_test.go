@@ -0,0 +1,44 @@
+package services
+
+import "testing"
+
+func TestCollectUnresolved(t *testing.T) {
+	devices := []Device{{ID: "web", Name: "web", Addresses: []string{"100.64.0.1"}}}
+	flows := []RawFlowEntry{
+		// Neither side resolves
+		{SourceIP: "10.0.0.5", DestinationIP: "100.64.0.9", TotalBytes: 100},
+		{SourceIP: "10.0.0.5", DestinationIP: "10.0.0.6", TotalBytes: 10},
+		// A device on either end resolves the flow
+		{SourceIP: "100.64.0.1", DestinationIP: "10.0.0.7", TotalBytes: 1000},
+		{SourceIP: "10.0.0.8", DestinationIP: "100.64.0.1", TotalBytes: 1000},
+		// So does a VIP service destination
+		{SourceIP: "10.0.0.9", DestinationIP: "100.100.0.1", DestinationService: "svc:db", TotalBytes: 1000},
+		// Public, multicast and link-local endpoints are never listed
+		{SourceIP: "10.0.0.6", DestinationIP: "8.8.8.8", TotalBytes: 1},
+		{SourceIP: "10.0.0.6", DestinationIP: "224.0.0.251", TotalBytes: 1},
+		{SourceIP: "fe80::1", DestinationIP: "ff02::fb", TotalBytes: 1},
+		{SourceIP: "169.254.1.1", DestinationIP: "10.0.0.6", TotalBytes: 1},
+	}
+
+	got := CollectUnresolved(devices, flows)
+	want := []struct {
+		ip    string
+		bytes int64
+		flows int
+		peers int
+	}{
+		{"10.0.0.5", 110, 2, 2},
+		{"100.64.0.9", 100, 1, 1},
+		{"10.0.0.6", 13, 4, 4},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d endpoints, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		e := got[i]
+		if e.IP != w.ip || e.TotalBytes != w.bytes || e.FlowCount != w.flows || e.Peers != w.peers {
+			t.Errorf("endpoint %d = %s %d bytes %d flows %d peers, want %s %d %d %d",
+				i, e.IP, e.TotalBytes, e.FlowCount, e.Peers, w.ip, w.bytes, w.flows, w.peers)
+		}
+	}
+}
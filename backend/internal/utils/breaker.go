@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling the Tailscale API while the
+// circuit breaker is open
+var ErrCircuitOpen = errors.New("upstream unavailable: Tailscale API circuit breaker is open after repeated failures")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets a single probe through to test recovery
+	CircuitHalfOpen
+	// CircuitOpen fails every request fast until the cooldown ends
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops calls to a failing upstream. After threshold
+// consecutive failures it opens and rejects calls for cooldown, then
+// half-opens to let one probe through: success closes it, failure reopens it.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	// OnStateChange, when set, is called with the new state on every transition
+	OnStateChange func(CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// NewCircuitBreaker returns a closed breaker. A threshold below 1 disables it.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a call may proceed, returning ErrCircuitOpen if not.
+// Every allowed call must be followed by Record or Abandon.
+func (cb *CircuitBreaker) Allow() error {
+	if cb.threshold < 1 {
+		return nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return ErrCircuitOpen
+		}
+		cb.setState(CircuitHalfOpen)
+		cb.probing = true
+		return nil
+	case CircuitHalfOpen:
+		// Only one probe at a time; the rest fail fast until it reports back
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a call let through by Allow
+func (cb *CircuitBreaker) Record(success bool) {
+	if cb.threshold < 1 {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if success {
+		cb.failures = 0
+		cb.probing = false
+		if cb.state != CircuitClosed {
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+		cb.probing = false
+		cb.openedAt = cb.now()
+		if cb.state != CircuitOpen {
+			cb.setState(CircuitOpen)
+		}
+	}
+}
+
+// Abandon releases a call let through by Allow without recording an outcome,
+// for calls the caller cancelled before the upstream answered
+func (cb *CircuitBreaker) Abandon() {
+	if cb.threshold < 1 {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// State returns the current state
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	cb.state = state
+	if cb.OnStateChange != nil {
+		cb.OnStateChange(state)
+	}
+}
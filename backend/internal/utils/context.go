@@ -0,0 +1,25 @@
+package utils
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// LogPrefix returns "[request <id>] " for log lines about ctx's request, or ""
+// when ctx carries no request ID
+func LogPrefix(ctx context.Context) string {
+	if id := RequestID(ctx); id != "" {
+		return "[request " + id + "] "
+	}
+	return ""
+}
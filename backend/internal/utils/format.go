@@ -0,0 +1,30 @@
+package utils
+
+import "fmt"
+
+// FormatBytes renders a byte count with IEC (1024-based) units, e.g. 1023 B,
+// 1.0 KiB, 1.5 MiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	if n < unit {
+		return fmt.Sprintf("%s%d B", sign, n)
+	}
+
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	i := -1
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	// Rounding can carry into the next unit, e.g. 1048575 B is 1024.0 KiB
+	if value >= unit-0.05 && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%s%.1f %s", sign, value, units[i])
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1, "1 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1048575, "1.0 MiB"},
+		{1 << 20, "1.0 MiB"},
+		{3 << 19, "1.5 MiB"},
+		{5 << 30, "5.0 GiB"},
+		{-1023, "-1023 B"},
+		{-(3 << 19), "-1.5 MiB"},
+		{math.MaxInt64, "8.0 EiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
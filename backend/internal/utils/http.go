@@ -2,8 +2,14 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -12,7 +18,43 @@ func IsRetryable(err error) bool {
 		return false
 	}
 	
-	if err == context.DeadlineExceeded {
+	// The caller gave up; another attempt would only waste an upstream call
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	// The breaker has already decided the upstream is down
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	// A per-attempt deadline (http.Client.Timeout or a dial timeout) is worth
+	// retrying; the retry loop itself stops once the caller's context is done
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	// The connection dropped before the full response arrived
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// The status code is authoritative; the body text may mention anything
+		switch apiErr.StatusCode {
+		case 429, 502, 503, 504:
+			return true
+		}
 		return false
 	}
 	
@@ -31,21 +73,71 @@ func FormatTimeForAPI(t time.Time) string {
 	return t.Format(time.RFC3339)
 }
 
-func HTTPError(status int, body string) error {
+// MaxRetryAfter caps how long a server-requested Retry-After can delay a retry
+const MaxRetryAfter = 2 * time.Minute
+
+// APIError is a non-200 response from the Tailscale API
+type APIError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay the server asked for, zero when it sent none
+	RetryAfter time.Duration
+
+	message string
+}
+
+func (e *APIError) Error() string {
+	return e.message
+}
+
+func HTTPError(status int, body string) *APIError {
+	apiErr := &APIError{StatusCode: status, Body: body}
 	switch status {
 	case 401:
-		return fmt.Errorf("bad auth - check your API key")
+		apiErr.message = "bad auth - check your API key"
 	case 403:
-		return fmt.Errorf("missing permissions (need logs:network:read)")
+		apiErr.message = "missing permissions (need logs:network:read)"
 	case 404:
-		return fmt.Errorf("tailnet not found")
+		apiErr.message = "tailnet not found"
 	case 429:
-		return fmt.Errorf("rate limited - slow down")
+		apiErr.message = "rate limited - slow down"
 	case 504:
-		return fmt.Errorf("timeout - try smaller time range")
+		apiErr.message = "timeout - try smaller time range"
 	case 503:
-		return fmt.Errorf("tailscale API down")
+		apiErr.message = "tailscale API down"
 	default:
-		return fmt.Errorf("API error %d: %s", status, body)
+		apiErr.message = fmt.Sprintf("API error %d: %s", status, body)
+	}
+	return apiErr
+}
+
+// ParseRetryAfter parses a Retry-After header in either delay-seconds or HTTP-date
+// form, clamped to [0, MaxRetryAfter]. It returns zero if the header is absent or invalid.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		// Clamp before multiplying, which overflows for large values; values out
+		// of int64 range parse as the nearest bound
+		if seconds > int64(MaxRetryAfter/time.Second) {
+			return MaxRetryAfter
+		}
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = at.Sub(now)
+	} else {
+		return 0
 	}
-}
\ No newline at end of file
+
+	if delay < 0 {
+		return 0
+	}
+	if delay > MaxRetryAfter {
+		return MaxRetryAfter
+	}
+	return delay
+}
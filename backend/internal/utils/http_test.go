@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error reporting a timeout, like a dial or read deadline
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o deadline reached" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("boom"), false},
+
+		{"429", HTTPError(429, ""), true},
+		{"502", HTTPError(502, ""), true},
+		{"503", HTTPError(503, ""), true},
+		{"504", HTTPError(504, ""), true},
+		{"500", HTTPError(500, "internal"), false},
+		{"400", HTTPError(400, "bad request"), false},
+		{"401", HTTPError(401, ""), false},
+		{"wrapped 503", fmt.Errorf("fetch devices: %w", HTTPError(503, "")), true},
+
+		{"net timeout", timeoutError{}, true},
+		{"url error wrapping timeout", &url.Error{Op: "Get", URL: "https://api.tailscale.com", Err: timeoutError{}}, true},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"wrapped deadline exceeded", fmt.Errorf("failed to make request: %w", context.DeadlineExceeded), true},
+		{"os deadline", fmt.Errorf("read: %w", os.ErrDeadlineExceeded), true},
+
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"connection reset", fmt.Errorf("read body: %w", syscall.ECONNRESET), true},
+		{"eof", io.EOF, true},
+		{"unexpected eof", fmt.Errorf("failed to read response body: %w", io.ErrUnexpectedEOF), true},
+
+		{"canceled", context.Canceled, false},
+		{"wrapped canceled", fmt.Errorf("failed to make request: %w", &url.Error{Op: "Get", URL: "https://api.tailscale.com", Err: context.Canceled}), false},
+		{"circuit open", fmt.Errorf("failed to make request: %w", ErrCircuitOpen), false},
+		{"400 mentioning timeout", HTTPError(400, "invalid timeout parameter"), false},
+		{"api error 404", HTTPError(404, "not found"), false},
+		{"api error 403", HTTPError(403, ""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	httpDate := func(d time.Duration) string {
+		return now.Add(d).Format(http.TimeFormat)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"absent", "", 0},
+		{"delta seconds", "30", 30 * time.Second},
+		{"delta seconds with spaces", " 5 ", 5 * time.Second},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-10", 0},
+		{"seconds over the clamp", "3600", MaxRetryAfter},
+		{"seconds that overflow a duration", "9223372037", MaxRetryAfter},
+		{"seconds at the int64 limit", "9223372036854775807", MaxRetryAfter},
+		{"seconds beyond int64", "99999999999999999999", MaxRetryAfter},
+		{"negative seconds beyond int64", "-99999999999999999999", 0},
+		{"http date", httpDate(45 * time.Second), 45 * time.Second},
+		{"http date in the past", httpDate(-time.Minute), 0},
+		{"http date over the clamp", httpDate(time.Hour), MaxRetryAfter},
+		{"garbage", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("ParseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,35 +1,63 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// Embed zone data for ?tz=; the runtime image has none
+	_ "time/tzdata"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/rajsinghtech/tsflow/backend/internal/config"
 	"github.com/rajsinghtech/tsflow/backend/internal/handlers"
+	"github.com/rajsinghtech/tsflow/backend/internal/metrics"
+	"github.com/rajsinghtech/tsflow/backend/internal/middleware"
 	"github.com/rajsinghtech/tsflow/backend/internal/services"
 )
 
-// customLoggingMiddleware provides structured request logging for production
-func customLoggingMiddleware() gin.HandlerFunc {
-	return gin.LoggerWithConfig(gin.LoggerConfig{
-		Formatter: func(param gin.LogFormatterParams) string {
-			return fmt.Sprintf("[%s] %s %s %d %s %s\n",
-				param.TimeStamp.Format("2006/01/02 - 15:04:05"),
-				param.Method,
-				param.Path,
-				param.StatusCode,
-				param.Latency,
-				param.ClientIP,
-			)
-		},
-		Output: os.Stdout,
-		SkipPaths: []string{"/health"}, // Skip health checks to reduce noise
-	})
+// shutdownGracePeriod bounds how long in-flight requests may run after SIGTERM.
+// Keep it below the pod's terminationGracePeriodSeconds.
+const shutdownGracePeriod = 60 * time.Second
+
+// logStartupBanner logs the server settings, as a single JSON object when
+// TSFLOW_LOG_FORMAT=json so log pipelines can parse it
+func logStartupBanner(cfg *config.Config, port, distPath string) {
+	auth := "API Key"
+	if cfg.TailscaleOAuthClientID != "" && cfg.TailscaleOAuthClientSecret != "" {
+		auth = fmt.Sprintf("OAuth Client Credentials (Client ID: %s)", cfg.TailscaleOAuthClientID)
+	}
+
+	if cfg.LogFormat == middleware.LogFormatJSON {
+		line, _ := json.Marshal(map[string]string{
+			"time":           time.Now().UTC().Format(time.RFC3339),
+			"msg":            "TSFlow server starting",
+			"port":           port,
+			"tailnet":        cfg.TailscaleTailnet,
+			"api_url":        cfg.TailscaleAPIURL,
+			"environment":    cfg.Environment,
+			"static_files":   distPath,
+			"authentication": auth,
+		})
+		fmt.Fprintln(os.Stdout, string(line))
+		return
+	}
+
+	log.Printf("=== TSFlow Server Starting ===")
+	log.Printf("Port: %s", port)
+	log.Printf("Tailnet: %s", cfg.TailscaleTailnet)
+	log.Printf("API URL: %s", cfg.TailscaleAPIURL)
+	log.Printf("Environment: %s", cfg.Environment)
+	log.Printf("Static files: %s", distPath)
+	log.Printf("Authentication: %s", auth)
 }
 
 func main() {
@@ -47,7 +75,7 @@ func main() {
 	}
 
 	tailscaleService := services.NewTailscaleService(cfg)
-	handlerService := handlers.NewHandlers(tailscaleService)
+	handlerService := handlers.NewHandlers(tailscaleService, cfg)
 
 	// Configure Gin logging
 	var router *gin.Engine
@@ -58,35 +86,78 @@ func main() {
 		gin.DefaultErrorWriter = os.Stderr
 		router = gin.New()
 		router.Use(gin.Recovery())
-		router.Use(customLoggingMiddleware())
+		router.Use(middleware.Logger(cfg.LogFormat))
+	} else if cfg.LogFormat == middleware.LogFormatJSON {
+		router = gin.New()
+		router.Use(gin.Recovery())
+		router.Use(middleware.Logger(cfg.LogFormat))
 	} else {
 		router = gin.Default()
 	}
 
+	// Only listed proxies may set the client IP via X-Forwarded-For; otherwise
+	// any client could pick its own rate limit bucket
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Configuration error: TSFLOW_TRUSTED_PROXIES: %v", err)
+	}
+
+	router.Use(middleware.RequestID())
+
 	// Add gzip compression middleware
 	router.Use(gzip.Gzip(gzip.DefaultCompression))
+	router.Use(metrics.Middleware())
 
-	corsConfig := cors.DefaultConfig()
-	if cfg.Environment == "production" {
-		corsConfig.AllowOrigins = []string{"https://tsflow.production.com"}
-		corsConfig.AllowAllOrigins = false
-	} else {
-		corsConfig.AllowOrigins = []string{"http://localhost:3000", "http://localhost:5173"}
-	}
-	corsConfig.AllowCredentials = true
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	router.Use(cors.New(corsConfig))
+	router.Use(middleware.CORS(cfg.CORSOrigins, cfg.Environment))
 
 	router.GET("/health", handlerService.HealthCheck)
+	router.GET("/health/ready", handlerService.ReadinessCheck)
+	router.GET("/metrics", metrics.Handler())
 
 	api := router.Group("/api")
+	if cfg.RateLimitRPS > 0 {
+		api.Use(middleware.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst).Middleware())
+	}
+	authConfig := middleware.AuthConfig{
+		BearerToken:   cfg.AuthToken,
+		BasicUser:     cfg.BasicAuthUser,
+		BasicPassword: cfg.BasicAuthPassword,
+	}
+	if authConfig.Enabled() {
+		api.Use(middleware.Auth(authConfig))
+	} else {
+		log.Printf("WARNING No TSFLOW_AUTH_TOKEN or TSFLOW_BASIC_AUTH set, /api is open to anyone who can reach this server")
+	}
 	{
+		api.GET("/config", middleware.RequireAdmin(cfg.AdminToken), handlerService.GetConfig)
+		api.GET("/summary", handlerService.GetSummary)
+		api.GET("/top-talkers", handlerService.GetTopTalkers)
 		api.GET("/devices", handlerService.GetDevices)
+		api.GET("/devices/stale", handlerService.GetStaleDevices)
+		api.GET("/devices/search", handlerService.SearchDevices)
+		api.GET("/devices/stats", handlerService.GetDeviceStats)
 		api.GET("/services-records", handlerService.GetServicesAndRecords)
+		api.GET("/services", handlerService.GetServicesAndRecords)
 		api.GET("/network-logs", handlerService.GetNetworkLogs)
 		api.GET("/network-map", handlerService.GetNetworkMap)
+		api.GET("/devices/:deviceId", handlerService.GetDevice)
 		api.GET("/devices/:deviceId/flows", handlerService.GetDeviceFlows)
+		api.GET("/raw-flows/stream", handlerService.StreamRawFlows)
+		api.GET("/protocols", handlerService.GetProtocols)
+		api.GET("/ports", handlerService.GetPorts)
+		api.GET("/flows/export-pcap-summary", handlerService.ExportFlowSummary)
+		api.GET("/flows/search", handlerService.SearchFlows)
+		api.GET("/flow-timeseries", handlerService.GetFlowTimeSeries)
+		api.GET("/filters/validate", handlerService.ValidateFilters)
+		api.GET("/flows/ip/:ip", handlerService.GetIPFlows)
+		api.GET("/flows/anomalies", handlerService.GetFlowAnomalies)
+		api.GET("/flows/retransmit-hotspots", handlerService.GetRetransmitHotspots)
+		api.GET("/flows/sankey", handlerService.GetFlowSankey)
+		api.GET("/flows/device-pairs", handlerService.GetDevicePairs)
+		api.GET("/flows/ports-scan-detection", handlerService.GetPortScans)
+		api.GET("/flows/unresolved", handlerService.GetUnresolvedFlows)
+		api.GET("/flows/subnets", handlerService.GetSubnets)
+		api.GET("/exit-nodes/traffic", handlerService.GetExitNodeTraffic)
+		api.GET("/dns", handlerService.GetDNS)
 		api.GET("/dns/nameservers", handlerService.GetDNSNameservers)
 	}
 
@@ -112,24 +183,41 @@ func main() {
 		port = cfg.Port
 	}
 
-	log.Printf("=== TSFlow Server Starting ===")
-	log.Printf("Port: %s", port)
-	log.Printf("Tailnet: %s", cfg.TailscaleTailnet)
-	log.Printf("API URL: %s", cfg.TailscaleAPIURL)
-	log.Printf("Environment: %s", cfg.Environment)
-	log.Printf("Static files: %s", distPath)
-	
-	// Log authentication method being used
-	if cfg.TailscaleOAuthClientID != "" && cfg.TailscaleOAuthClientSecret != "" {
-		log.Printf("Authentication: OAuth Client Credentials (Client ID: %s)", cfg.TailscaleOAuthClientID)
-	} else {
-		log.Printf("Authentication: API Key")
+	logStartupBanner(cfg, port, distPath)
+
+	srv := &http.Server{
+		Addr:              "0.0.0.0:" + port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		// Long-range network log queries can take up to 30 minutes upstream
+		WriteTimeout: 35 * time.Minute,
+		IdleTimeout:  2 * time.Minute,
 	}
-	
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("FATAL Failed to start server: %v", err)
+		}
+	}()
+
 	log.Printf("Server ready at http://0.0.0.0:%s", port)
 	log.Printf("=== Server Started Successfully ===")
 
-	if err := router.Run("0.0.0.0:" + port); err != nil {
-		log.Fatalf("FATAL Failed to start server: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	// Give in-flight requests, including slow chunked log fetches, time to finish
+	log.Printf("Shutdown signal received, draining requests for up to %v", shutdownGracePeriod)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("ERROR Graceful shutdown incomplete, forcing close: %v", err)
+		srv.Close()
 	}
+
+	log.Printf("=== Server Stopped ===")
 }